@@ -3,13 +3,16 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/nipunap/sqlite-mcp-server/internal/config"
 	"github.com/nipunap/sqlite-mcp-server/internal/db"
 	"github.com/nipunap/sqlite-mcp-server/internal/mcp"
 )
@@ -18,8 +21,21 @@ func main() {
 	// Parse flags
 	registryPath := flag.String("registry", "registry.db", "Path to database registry")
 	defaultDB := flag.String("db", "", "Default database to register (optional)")
+	configPath := flag.String("config", "", "Path to JSON configuration file (optional)")
+	transport := flag.String("transport", "stdio", "Transport to serve: stdio or http")
+	httpAddr := flag.String("http-addr", "", "Address for the HTTP transport (default: server.host:server.port from config)")
+	httpEndpoint := flag.String("http-endpoint", "/mcp", "Endpoint path for the HTTP transport")
+	maxWorkers := flag.Int("max-workers", 0, "Maximum number of requests executed concurrently (default: server.max_workers from config)")
+	queryTimeout := flag.Duration("query-timeout", 0, "Default db/query timeout, e.g. 30s (default: database.query_timeout_ms from config)")
+	listen := flag.String("listen", "", "Serve newline-delimited JSON-RPC on a socket: unix:/path/to/socket or tcp:host:port")
 	flag.Parse()
 
+	// Load configuration
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	// Create absolute path for registry
 	absRegistryPath, err := filepath.Abs(*registryPath)
 	if err != nil {
@@ -45,6 +61,21 @@ func main() {
 		}
 	}()
 
+	// Apply the configured result limits
+	databaseLimits := make(map[string]db.Limits, len(cfg.Limits.Databases))
+	for name, limits := range cfg.Limits.Databases {
+		databaseLimits[name] = db.Limits(limits)
+	}
+	manager.SetLimits(db.Limits(cfg.Limits.Default), db.Limits(cfg.Limits.Ceiling), databaseLimits)
+	manager.SetTransactionIdleTimeout(time.Duration(cfg.Database.TransactionIdleTimeoutMS) * time.Millisecond)
+
+	// Apply the configured connection options
+	connectionDefaults := db.ConnectionOptions(cfg.Database.Connection)
+	if err := connectionDefaults.Validate(); err != nil {
+		log.Fatalf("Invalid database.connection options: %v", err)
+	}
+	manager.SetConnectionDefaults(connectionDefaults)
+
 	// Register default database if provided
 	if *defaultDB != "" {
 		absDefaultDB, err := filepath.Abs(*defaultDB)
@@ -82,6 +113,20 @@ func main() {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
+	workers := *maxWorkers
+	if workers <= 0 {
+		workers = cfg.Server.MaxWorkers
+	}
+	if workers > 0 {
+		server.SetMaxWorkers(workers)
+	}
+
+	timeout := *queryTimeout
+	if timeout <= 0 {
+		timeout = time.Duration(cfg.Database.QueryTimeoutMS) * time.Millisecond
+	}
+	server.SetQueryTimeout(timeout)
+
 	// Set up context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -94,8 +139,34 @@ func main() {
 		cancel()
 	}()
 
-	// Run server using STDIO transport
-	if err := server.Run(ctx); err != nil {
+	// Select the transport
+	switch {
+	case *listen != "":
+		if *transport != "stdio" {
+			log.Fatalf("--listen cannot be combined with --transport %s", *transport)
+		}
+		listener, err := mcp.ParseListenAddress(*listen)
+		if err != nil {
+			log.Fatalf("Invalid --listen address: %v", err)
+		}
+		log.Printf("Serving MCP on %s", *listen)
+		server.SetTransport(listener)
+	case *transport == "stdio":
+		// STDIO is the server's default transport
+	case *transport == "http":
+		addr := *httpAddr
+		if addr == "" {
+			addr = fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+		}
+		log.Printf("Serving MCP over HTTP at http://%s%s", addr, *httpEndpoint)
+		httpTransport := mcp.NewHTTPTransport(addr, *httpEndpoint)
+		httpTransport.SetSessionIdleTimeout(time.Duration(cfg.Server.SessionIdleTimeoutMS) * time.Millisecond)
+		server.SetTransport(httpTransport)
+	default:
+		log.Fatalf("Unknown transport %q: expected stdio or http", *transport)
+	}
+
+	if err := server.Run(ctx); err != nil && err != context.Canceled {
 		log.Fatalf("Server error: %v", err)
 	}
 }
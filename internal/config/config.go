@@ -8,33 +8,73 @@ import (
 
 type Config struct {
 	Server struct {
-		Host string `json:"host"`
-		Port int    `json:"port"`
+		Host                 string `json:"host"`
+		Port                 int    `json:"port"`
+		MaxWorkers           int    `json:"max_workers"`
+		SessionIdleTimeoutMS int    `json:"session_idle_timeout_ms"` // unused HTTP sessions are removed after this long
 	} `json:"server"`
 	Database struct {
-		RegistryPath string `json:"registry_path"`
-		DataDir      string `json:"data_dir"`
+		RegistryPath             string `json:"registry_path"`
+		DataDir                  string `json:"data_dir"`
+		QueryTimeoutMS           int    `json:"query_timeout_ms"`
+		TransactionIdleTimeoutMS int    `json:"transaction_idle_timeout_ms"` // open transactions unused this long are rolled back
+
+		Connection ConnectionOptions `json:"connection"` // defaults for databases that do not set their own
 	} `json:"database"`
 	Auth struct {
 		Secret      string `json:"secret"`
 		TokenExpiry int    `json:"token_expiry"` // in hours
 	} `json:"auth"`
+	Limits struct {
+		Default   ResultLimits            `json:"default"`
+		Ceiling   ResultLimits            `json:"ceiling"`   // per-call limits may not exceed these
+		Databases map[string]ResultLimits `json:"databases"` // per-database defaults, zero fields inherit
+	} `json:"limits"`
+}
+
+// ConnectionOptions are the SQLite settings databases are opened with. Unset
+// fields keep the server's built-in defaults.
+type ConnectionOptions struct {
+	JournalMode   string `json:"journal_mode,omitempty"`
+	BusyTimeoutMS *int   `json:"busy_timeout_ms,omitempty"`
+	ForeignKeys   *bool  `json:"foreign_keys,omitempty"`
+	Synchronous   string `json:"synchronous,omitempty"`
+	CacheSize     *int   `json:"cache_size,omitempty"`
+	TempStore     string `json:"temp_store,omitempty"`
+	MmapSize      *int64 `json:"mmap_size,omitempty"`
+}
+
+// ResultLimits bounds the size of query results. Zero means no limit.
+type ResultLimits struct {
+	MaxRows      int `json:"max_rows"`
+	MaxBytes     int `json:"max_bytes"`
+	MaxCellBytes int `json:"max_cell_bytes"`
 }
 
 var DefaultConfig = Config{
 	Server: struct {
-		Host string `json:"host"`
-		Port int    `json:"port"`
+		Host                 string `json:"host"`
+		Port                 int    `json:"port"`
+		MaxWorkers           int    `json:"max_workers"`
+		SessionIdleTimeoutMS int    `json:"session_idle_timeout_ms"`
 	}{
-		Host: "localhost",
-		Port: 8080,
+		Host:                 "localhost",
+		Port:                 8080,
+		MaxWorkers:           8,
+		SessionIdleTimeoutMS: 1800000,
 	},
 	Database: struct {
-		RegistryPath string `json:"registry_path"`
-		DataDir      string `json:"data_dir"`
+		RegistryPath             string `json:"registry_path"`
+		DataDir                  string `json:"data_dir"`
+		QueryTimeoutMS           int    `json:"query_timeout_ms"`
+		TransactionIdleTimeoutMS int    `json:"transaction_idle_timeout_ms"`
+
+		Connection ConnectionOptions `json:"connection"`
 	}{
-		RegistryPath: "data/registry.db",
-		DataDir:      "data/databases",
+		RegistryPath:             "data/registry.db",
+		DataDir:                  "data/databases",
+		QueryTimeoutMS:           30000,
+		TransactionIdleTimeoutMS: 60000,
 	},
 	Auth: struct {
 		Secret      string `json:"secret"`
@@ -43,6 +83,22 @@ var DefaultConfig = Config{
 		Secret:      "change-me-in-production",
 		TokenExpiry: 24,
 	},
+	Limits: struct {
+		Default   ResultLimits            `json:"default"`
+		Ceiling   ResultLimits            `json:"ceiling"`
+		Databases map[string]ResultLimits `json:"databases"`
+	}{
+		Default: ResultLimits{
+			MaxRows:      1000,
+			MaxBytes:     1 << 20,
+			MaxCellBytes: 64 << 10,
+		},
+		Ceiling: ResultLimits{
+			MaxRows:      100000,
+			MaxBytes:     16 << 20,
+			MaxCellBytes: 1 << 20,
+		},
+	},
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -0,0 +1,162 @@
+/*
+Package cursor provides the opaque continuation tokens used to paginate
+results.
+
+Short, stable lists such as registered databases or MCP tool listings use
+stateless offset cursors created with EncodeOffset. Query results use a
+Store, which keeps the state needed to resume a query on the server and
+hands out random tokens that expire after a period of inactivity.
+*/
+package cursor
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed, unknown or expired
+var ErrInvalidCursor = errors.New("invalid or expired cursor")
+
+// offsetPrefix marks stateless offset cursors
+const offsetPrefix = "offset:"
+
+// EncodeOffset returns an opaque cursor resuming a list at offset
+func EncodeOffset(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(offsetPrefix + strconv.Itoa(offset)))
+}
+
+// DecodeOffset returns the offset encoded in a cursor made by EncodeOffset.
+// An empty cursor is the start of the list.
+func DecodeOffset(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(data), offsetPrefix) {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(data), offsetPrefix))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// Page returns the bounds of the page of a list of length n starting at the
+// offset encoded in cursor, and the cursor of the following page or "" when
+// the page is the last one. A pageSize of zero or less returns the whole list.
+func Page(n int, cursor string, pageSize int) (start, end int, next string, err error) {
+	start, err = DecodeOffset(cursor)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if start > n {
+		return 0, 0, "", ErrInvalidCursor
+	}
+
+	end = n
+	if pageSize > 0 && start+pageSize < n {
+		end = start + pageSize
+		next = EncodeOffset(end)
+	}
+	return start, end, next, nil
+}
+
+// DefaultMaxEntries is how many cursors a Store keeps before evicting the
+// least recently used one
+const DefaultMaxEntries = 1000
+
+// Store keeps server-side cursor state. Entries expire when they have not
+// been used for the store's TTL, and the least recently used entry is evicted
+// when the store is full.
+type Store struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	state   interface{}
+	expires time.Time
+}
+
+// NewStore creates a cursor store whose entries expire after ttl of inactivity
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, max: DefaultMaxEntries, entries: make(map[string]*entry)}
+}
+
+// Put saves state and returns the cursor referring to it
+func (s *Store) Put(state interface{}) string {
+	buf := make([]byte, 18)
+	_, _ = rand.Read(buf)
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked(time.Now())
+	if len(s.entries) >= s.max {
+		s.evictOldestLocked()
+	}
+	s.entries[token] = &entry{state: state, expires: time.Now().Add(s.ttl)}
+	return token
+}
+
+// Get returns the state saved for cursor and extends its lifetime
+func (s *Store) Get(cursor string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e, ok := s.entries[cursor]
+	if !ok || now.After(e.expires) {
+		delete(s.entries, cursor)
+		return nil, ErrInvalidCursor
+	}
+	e.expires = now.Add(s.ttl)
+	return e.state, nil
+}
+
+// Delete discards the state saved for cursor
+func (s *Store) Delete(cursor string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, cursor)
+}
+
+// Len returns the number of live cursors
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+	return len(s.entries)
+}
+
+// evictOldestLocked drops the entry closest to expiry, which is the one used
+// least recently
+func (s *Store) evictOldestLocked() {
+	var oldest string
+	var expires time.Time
+	for token, e := range s.entries {
+		if oldest == "" || e.expires.Before(expires) {
+			oldest, expires = token, e.expires
+		}
+	}
+	delete(s.entries, oldest)
+}
+
+func (s *Store) expireLocked(now time.Time) {
+	for token, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, token)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package cursor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOffsetCursor(t *testing.T) {
+	for _, offset := range []int{0, 1, 250} {
+		got, err := DecodeOffset(EncodeOffset(offset))
+		if err != nil || got != offset {
+			t.Errorf("Round trip of %d gave %d, %v", offset, got, err)
+		}
+	}
+
+	for _, bad := range []string{"not base64!", EncodeOffset(-1), "b2Zmc2V0Onh5eg"} {
+		if _, err := DecodeOffset(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	// Walk a list of 7 entries in pages of 3
+	var bounds [][2]int
+	next := ""
+	for {
+		start, end, cursor, err := Page(7, next, 3)
+		if err != nil {
+			t.Fatalf("Page failed: %v", err)
+		}
+		bounds = append(bounds, [2]int{start, end})
+		if cursor == "" {
+			break
+		}
+		next = cursor
+	}
+	if len(bounds) != 3 || bounds[0] != [2]int{0, 3} || bounds[2] != [2]int{6, 7} {
+		t.Errorf("Unexpected pages %v", bounds)
+	}
+
+	// No page size returns everything
+	if start, end, next, err := Page(7, "", 0); err != nil || start != 0 || end != 7 || next != "" {
+		t.Errorf("Expected whole list, got %d %d %q %v", start, end, next, err)
+	}
+
+	if _, _, _, err := Page(7, EncodeOffset(8), 3); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor past the end, got %v", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(50 * time.Millisecond)
+
+	token := store.Put("state")
+	if state, err := store.Get(token); err != nil || state != "state" {
+		t.Fatalf("Get returned %v, %v", state, err)
+	}
+	if _, err := store.Get("unknown"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for unknown cursor, got %v", err)
+	}
+
+	store.Delete(token)
+	if _, err := store.Get(token); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor after Delete, got %v", err)
+	}
+
+	// Unused cursors expire
+	token = store.Put("state")
+	time.Sleep(100 * time.Millisecond)
+	if _, err := store.Get(token); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor after expiry, got %v", err)
+	}
+	if store.Len() != 0 {
+		t.Errorf("Expected expired cursors to be dropped, got %d", store.Len())
+	}
+}
+
+func TestStoreEviction(t *testing.T) {
+	store := NewStore(time.Minute)
+	store.max = 3
+
+	first := store.Put("first")
+	time.Sleep(time.Millisecond)
+	second := store.Put("second")
+	time.Sleep(time.Millisecond)
+	third := store.Put("third")
+	time.Sleep(time.Millisecond)
+
+	// Using the first cursor makes the second the least recently used
+	if _, err := store.Get(first); err != nil {
+		t.Fatalf("Get returned %v", err)
+	}
+	fourth := store.Put("fourth")
+
+	if store.Len() != 3 {
+		t.Errorf("Expected the store to stay at 3 entries, got %d", store.Len())
+	}
+	if _, err := store.Get(second); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected the least recently used cursor to be evicted, got %v", err)
+	}
+	for _, token := range []string{first, third, fourth} {
+		if _, err := store.Get(token); err != nil {
+			t.Errorf("Expected cursor %s to survive eviction, got %v", token, err)
+		}
+	}
+}
@@ -3,27 +3,66 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"strings"
 	"sync"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/progress"
 )
 
+// BatchOperation is a single statement of a batch
 type BatchOperation struct {
-	Database string        `json:"database"`
-	Query    string        `json:"query"`
-	Args     []interface{} `json:"args"`
+	Database string        `json:"database" description:"Name of the registered database"`
+	Query    string        `json:"query" description:"SQL statement with ? placeholders"`
+	Args     []interface{} `json:"args,omitempty" description:"Values bound to the placeholders"`
+	Format   string        `json:"format,omitempty" enum:"json,table,markdown,csv,ndjson" description:"Format of the returned rows, json by default"` // one of the Format constants
 }
 
+// BatchResult is the outcome of a single operation of a batch
 type BatchResult struct {
 	Database string      `json:"database"`
 	Success  bool        `json:"success"`
-	Results  interface{} `json:"results,omitempty"`
-	Error    string      `json:"error,omitempty"`
+	Columns  []Column    `json:"columns,omitempty" description:"Result columns with their declared types, for the table format"`
+	MimeType string      `json:"mime_type,omitempty" description:"MIME type of a text format, whose results are a string"`
+	Results  interface{} `json:"results,omitempty" description:"Rows returned by the statement"`
+	// RowsAffected counts the rows the statement inserted, updated or deleted
+	RowsAffected int64  `json:"rows_affected,omitempty" description:"Number of rows the statement inserted, updated or deleted"`
+	Error        string `json:"error,omitempty"`
+	// RolledBack is set in a failed atomic batch on the operations whose changes were undone
+	RolledBack bool `json:"rolled_back,omitempty" description:"Whether the changes of this operation were undone because the atomic batch failed"`
+	Truncation
 }
 
+// Batch modes
+const (
+	// BatchParallel runs operations concurrently, each in its own transaction
+	BatchParallel = "parallel"
+	// BatchSequential runs operations in order, each in its own transaction
+	BatchSequential = "sequential"
+	// BatchAtomic runs operations in order in a single transaction that is
+	// rolled back when any of them fails
+	BatchAtomic = "atomic"
+)
+
+// ExecuteBatch runs each operation in its own transaction, reporting progress
+// through the tracker carried by ctx as operations complete. Results are cut
+// to the limits of their database.
 func (m *Manager) ExecuteBatch(ctx context.Context, operations []BatchOperation) []BatchResult {
+	return m.executeParallel(ctx, operations, false)
+}
+
+// executeParallel implements ExecuteBatch, rolling every operation back
+// instead of committing it when dryRun is set
+func (m *Manager) executeParallel(ctx context.Context, operations []BatchOperation, dryRun bool) []BatchResult {
 	results := make([]BatchResult, len(operations))
 	var wg sync.WaitGroup
 
+	tracker := progress.FromContext(ctx)
+	var completedMu sync.Mutex
+	completed := 0
+
 	// Create a buffered channel to limit concurrent operations
 	semaphore := make(chan struct{}, 5) // Max 5 concurrent operations
 
@@ -31,159 +70,418 @@ func (m *Manager) ExecuteBatch(ctx context.Context, operations []BatchOperation)
 		wg.Add(1)
 		go func(index int, operation BatchOperation) {
 			defer wg.Done()
+			defer func() {
+				completedMu.Lock()
+				defer completedMu.Unlock()
+				completed++
+				tracker.Report(float64(completed), float64(len(operations)),
+					fmt.Sprintf("Operation %d of %d on %s finished", index+1, len(operations), operation.Database))
+			}()
 
 			// Acquire semaphore
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			result := BatchResult{
-				Database: operation.Database,
-				Success:  false,
-			}
+			results[index] = m.executeOperation(ctx, operation, dryRun)
+		}(i, op)
+	}
 
-			// Get database connection
-			db, err := m.GetConnection(operation.Database)
-			if err != nil {
-				result.Error = err.Error()
-				results[index] = result
-				return
-			}
+	wg.Wait()
+	return results
+}
+
+// ExecuteBatchMode runs a batch in one of the batch modes, BatchParallel by
+// default. Atomic batches must target a single database. A dry run reports
+// the results of the operations but rolls back all of their changes.
+func (m *Manager) ExecuteBatchMode(ctx context.Context, mode string, operations []BatchOperation, dryRun bool) ([]BatchResult, error) {
+	switch mode {
+	case "", BatchParallel:
+		return m.executeParallel(ctx, operations, dryRun), nil
+	case BatchSequential:
+		tracker := progress.FromContext(ctx)
+		results := make([]BatchResult, len(operations))
+		for i, operation := range operations {
+			results[i] = m.executeOperation(ctx, operation, dryRun)
+			tracker.Report(float64(i+1), float64(len(operations)),
+				fmt.Sprintf("Operation %d of %d on %s finished", i+1, len(operations), operation.Database))
+		}
+		return results, nil
+	case BatchAtomic:
+		return m.executeAtomic(ctx, operations, dryRun)
+	}
+	return nil, fmt.Errorf("%w: unknown batch mode %q", ErrInvalidOperation, mode)
+}
+
+// executeOperation runs an operation in its own transaction, which is rolled
+// back in a dry run
+func (m *Manager) executeOperation(ctx context.Context, operation BatchOperation, dryRun bool) BatchResult {
+	result := BatchResult{
+		Database: operation.Database,
+		Success:  false,
+	}
+
+	// A statement ending the transaction would keep a dry run's changes
+	if err := checkOperation(operation); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Get database connection
+	conn, err := m.getConnection(operation.Database)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	tx, err := m.beginBatch(ctx, conn, operation)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer func() { tx.close(!result.Success) }()
+
+	result = m.runOperation(ctx, tx.Tx, operation)
+	if !result.Success || dryRun {
+		return result
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		result = BatchResult{Database: operation.Database, Error: err.Error()}
+	}
+	return result
+}
 
-			// Start transaction if needed
-			tx, err := db.BeginTx(ctx, &sql.TxOptions{
-				ReadOnly: false,
-			})
-			if err != nil {
-				result.Error = err.Error()
-				results[index] = result
-				return
+// executeAtomic runs all operations in order in a single transaction. When
+// an operation fails the transaction is rolled back: the operations before it
+// report the rollback and the ones after it are not run. A dry run rolls the
+// transaction back even when every operation succeeds.
+func (m *Manager) executeAtomic(ctx context.Context, operations []BatchOperation, dryRun bool) ([]BatchResult, error) {
+	if len(operations) == 0 {
+		return []BatchResult{}, nil
+	}
+	database := operations[0].Database
+	for _, operation := range operations[1:] {
+		if operation.Database != database {
+			return nil, fmt.Errorf("%w: an atomic batch must target a single database, got %s and %s",
+				ErrInvalidOperation, database, operation.Database)
+		}
+	}
+
+	for i, operation := range operations {
+		if err := checkOperation(operation); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i+1, err)
+		}
+	}
+
+	conn, err := m.getConnection(database)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := m.beginBatch(ctx, conn, operations...)
+	if err != nil {
+		return nil, err
+	}
+	discard := true
+	defer func() { tx.close(discard) }()
+
+	tracker := progress.FromContext(ctx)
+	results := make([]BatchResult, len(operations))
+	failed := -1
+	for i, operation := range operations {
+		results[i] = m.runOperation(ctx, tx.Tx, operation)
+		tracker.Report(float64(i+1), float64(len(operations)),
+			fmt.Sprintf("Operation %d of %d on %s finished", i+1, len(operations), operation.Database))
+		if !results[i].Success {
+			failed = i
+			break
+		}
+	}
+
+	if failed < 0 {
+		discard = false
+		if dryRun {
+			return results, nil
+		}
+		if err := tx.Commit(); err != nil {
+			discard = true
+			for i := range results {
+				results[i] = BatchResult{Database: database, Error: "commit failed: " + err.Error()}
 			}
-			defer tx.Rollback()
-
-			// Execute query
-			rows, err := tx.QueryContext(ctx, operation.Query, operation.Args...)
-			if err != nil {
-				result.Error = err.Error()
-				results[index] = result
-				return
+		}
+		return results, nil
+	}
+
+	for i := range results {
+		switch {
+		case i < failed:
+			results[i] = BatchResult{
+				Database:   database,
+				RolledBack: true,
+				Error:      fmt.Sprintf("rolled back because operation %d failed", failed+1),
 			}
-			defer rows.Close()
-
-			// Get column names
-			columns, err := rows.Columns()
-			if err != nil {
-				result.Error = err.Error()
-				results[index] = result
-				return
+		case i > failed:
+			results[i] = BatchResult{
+				Database: database,
+				Error:    fmt.Sprintf("not run because operation %d failed", failed+1),
 			}
+		default:
+			results[i].RolledBack = true
+		}
+	}
+	return results, nil
+}
 
-			// Prepare result set
-			var resultSet []map[string]interface{}
-			values := make([]interface{}, len(columns))
-			valuePtrs := make([]interface{}, len(columns))
+// checkOperation refuses an operation that is not a single statement, or
+// whose statement would end the transaction it runs in or change the state of
+// the connection running it, which a database's writer keeps across requests
+func checkOperation(operation BatchOperation) error {
+	statements := SplitStatements(operation.Query)
+	switch {
+	case len(statements) == 0:
+		return fmt.Errorf("%w: query is empty", ErrInvalidOperation)
+	case len(statements) > 1:
+		return fmt.Errorf("%w: multiple statements are not allowed in an operation", ErrInvalidOperation)
+	}
 
-			for i := range columns {
-				valuePtrs[i] = &values[i]
-			}
+	keyword := strings.ToUpper(leadingKeyword(statements[0]))
+	if stateChangingKeywords[keyword] {
+		return fmt.Errorf("%w: %s statements are not allowed in a batch", ErrInvalidOperation, keyword)
+	}
+	if keyword == "PRAGMA" && !readOnlyPragma(statements[0]) {
+		return fmt.Errorf("%w: only pragmas that read are allowed in a batch", ErrInvalidOperation)
+	}
+	return nil
+}
 
-			for rows.Next() {
-				if err := rows.Scan(valuePtrs...); err != nil {
-					result.Error = err.Error()
-					results[index] = result
-					return
-				}
-
-				row := make(map[string]interface{})
-				for i, col := range columns {
-					row[col] = values[i]
-				}
-				resultSet = append(resultSet, row)
-			}
+// batchTx is the transaction a batch runs in, with the pooled connection
+// holding it
+type batchTx struct {
+	*sql.Tx
+	conn *sql.Conn
+}
 
-			if err := rows.Err(); err != nil {
-				result.Error = err.Error()
-				results[index] = result
-				return
-			}
+// close rolls back what was not committed and returns the connection to its
+// pool. With discard set the connection is closed instead, so that whatever
+// state a failed operation left on it does not reach later requests.
+func (b *batchTx) close(discard bool) {
+	b.Tx.Rollback()
+	if discard {
+		b.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	b.conn.Close()
+}
 
-			// Commit transaction
-			if err := tx.Commit(); err != nil {
-				result.Error = err.Error()
-				results[index] = result
-				return
-			}
+// beginBatch starts the transaction operations run in: on the readers of the
+// database when they only read, so that they run alongside other reads, and
+// on its writer otherwise
+func (m *Manager) beginBatch(ctx context.Context, conn *connection, operations ...BatchOperation) (*batchTx, error) {
+	pool, options := conn.reader, &sql.TxOptions{ReadOnly: true}
+	for _, operation := range operations {
+		if readsOnly(ctx, conn.reader, operation.Query) {
+			continue
+		}
+		if err := m.checkNoTransaction(conn.info.Name); err != nil {
+			return nil, err
+		}
+		pool, options = conn.writer, &sql.TxOptions{ReadOnly: conn.info.ReadOnly}
+		break
+	}
 
-			result.Success = true
-			result.Results = resultSet
-			results[index] = result
-		}(i, op)
+	c, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.BeginTx(ctx, options)
+	if err != nil {
+		c.Close()
+		return nil, err
 	}
+	return &batchTx{Tx: tx, conn: c}, nil
+}
 
-	wg.Wait()
-	return results
+// runOperation runs an operation inside tx and reads its rows, cut to the
+// limits of its database
+func (m *Manager) runOperation(ctx context.Context, tx *sql.Tx, operation BatchOperation) BatchResult {
+	result := BatchResult{
+		Database: operation.Database,
+		Success:  false,
+	}
+
+	format, err := ParseFormat(operation.Format)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Changes are counted across the statement, including those of triggers
+	var changesBefore, changesAfter int64
+	if err := tx.QueryRowContext(ctx, "SELECT total_changes()").Scan(&changesBefore); err != nil {
+		result.Error = translateError(err).Error()
+		return result
+	}
+
+	// Execute query
+	rows, err := tx.QueryContext(ctx, operation.Query, operation.Args...)
+	if err != nil {
+		result.Error = translateError(err).Error()
+		return result
+	}
+	defer rows.Close()
+
+	columns, resultSet, truncation, err := ReadRows(rows, format, m.ResultLimits(operation.Database, Limits{}))
+	if err != nil {
+		result.Error = translateError(err).Error()
+		return result
+	}
+
+	// Release the statement before the transaction moves on
+	if err := rows.Close(); err != nil {
+		result.Error = translateError(err).Error()
+		return result
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT total_changes()").Scan(&changesAfter); err != nil {
+		result.Error = translateError(err).Error()
+		return result
+	}
+
+	result.Success = true
+	result.Results = resultSet
+	result.RowsAffected = changesAfter - changesBefore
+	if format == FormatTable {
+		result.Columns = columns
+	}
+	if IsTextFormat(format) {
+		result.MimeType = FormatMimeType(format)
+	}
+	result.Truncation = truncation
+	return result
 }
 
+// ErrInvalidOperation is returned for an operation that is malformed
+// regardless of the data it would touch
+var ErrInvalidOperation = errors.New("invalid operation")
+
+// maxBulkVariables is the number of values bound to a single INSERT of a
+// bulk insert, SQLite's default limit on host parameters
+const maxBulkVariables = 32766
+
+// BulkInsertOperation inserts rows of values for the same columns into a table
 type BulkInsertOperation struct {
 	Database   string          `json:"database"`
 	Table      string          `json:"table"`
 	Columns    []string        `json:"columns"`
 	Values     [][]interface{} `json:"values"`
-	OnConflict string          `json:"on_conflict,omitempty"`
+	OnConflict *Conflict       `json:"on_conflict,omitempty"`
 }
 
+// BulkInsert inserts all rows of an operation in one transaction, reporting
+// progress through the tracker carried by ctx. The table and columns are
+// checked against the schema before anything is written.
 func (m *Manager) BulkInsert(ctx context.Context, operation BulkInsertOperation) (int64, error) {
-	db, err := m.GetConnection(operation.Database)
-	if err != nil {
+	if err := m.CheckWritable(operation.Database); err != nil {
+		return 0, err
+	}
+	if err := m.checkNoTransaction(operation.Database); err != nil {
 		return 0, err
 	}
 
-	tx, err := db.BeginTx(ctx, nil)
+	db, err := m.getWriter(operation.Database)
 	if err != nil {
 		return 0, err
 	}
-	defer tx.Rollback()
-
-	// Build the query
-	query := buildBulkInsertQuery(operation)
 
-	// Flatten values for execution
-	flatValues := make([]interface{}, 0, len(operation.Values)*len(operation.Columns))
-	for _, row := range operation.Values {
-		flatValues = append(flatValues, row...)
+	_, statements, err := bulkStatements(ctx, db, operation)
+	if err != nil {
+		return 0, err
 	}
 
-	// Execute the bulk insert
-	result, err := tx.ExecContext(ctx, query, flatValues...)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
+
+	tracker := progress.FromContext(ctx)
+	total := len(operation.Values)
+	inserted := 0
+	var affected int64
+	for _, stmt := range statements {
+		result, err := tx.ExecContext(ctx, stmt.Query, stmt.Args...)
+		if err != nil {
+			return 0, translateError(err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		affected += n
+
+		inserted += len(stmt.Args) / len(operation.Columns)
+		if len(statements) > 1 {
+			tracker.Report(float64(inserted), float64(total), fmt.Sprintf("Inserted %d of %d rows", inserted, total))
+		}
+	}
 
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
 
-	return result.RowsAffected()
+	return affected, nil
 }
 
-func buildBulkInsertQuery(operation BulkInsertOperation) string {
-	// Build column list
-	columns := "(" + strings.Join(operation.Columns, ", ") + ")"
+// PreviewBulkInsert reports what a bulk insert would change without
+// changing anything. Changes are cut to limits.
+func (m *Manager) PreviewBulkInsert(ctx context.Context, operation BulkInsertOperation, limits Limits) (*Preview, error) {
+	db, err := m.GetConnection(operation.Database)
+	if err != nil {
+		return nil, err
+	}
+	table, statements, err := bulkStatements(ctx, db, operation)
+	if err != nil {
+		return nil, err
+	}
+	return m.Preview(ctx, operation.Database, table, limits, statements...)
+}
 
-	// Build placeholders for each row
-	placeholders := make([]string, len(operation.Values))
-	for i := range operation.Values {
-		rowPlaceholders := make([]string, len(operation.Columns))
-		for j := range operation.Columns {
-			rowPlaceholders[j] = "?"
+// bulkStatements checks a bulk insert against the schema of its table and
+// splits it into INSERT statements that stay below the host parameter limit
+func bulkStatements(ctx context.Context, q Queryer, operation BulkInsertOperation) (*Table, []Statement, error) {
+	table, err := LoadTable(ctx, q, operation.Table)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, row := range operation.Values {
+		if len(row) != len(operation.Columns) {
+			return nil, nil, fmt.Errorf("%w: row %d has %d values for %d columns", ErrInvalidOperation, i, len(row), len(operation.Columns))
 		}
-		placeholders[i] = "(" + strings.Join(rowPlaceholders, ", ") + ")"
 	}
 
-	query := "INSERT INTO " + operation.Table + " " + columns + " VALUES " + strings.Join(placeholders, ", ")
-
-	if operation.OnConflict != "" {
-		query += " " + operation.OnConflict
+	chunkRows := len(operation.Values)
+	if n := len(operation.Columns); n > 0 && chunkRows*n > maxBulkVariables {
+		chunkRows = maxBulkVariables / n
+	}
+	query, err := table.InsertRows(operation.Columns, chunkRows, operation.OnConflict)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidOperation, err)
 	}
 
-	return query
+	total := len(operation.Values)
+	var statements []Statement
+	for start := 0; start < total; start += chunkRows {
+		end := start + chunkRows
+		if end > total {
+			end = total
+			if query, err = table.InsertRows(operation.Columns, end-start, operation.OnConflict); err != nil {
+				return nil, nil, fmt.Errorf("%w: %w", ErrInvalidOperation, err)
+			}
+		}
+
+		values := make([]interface{}, 0, (end-start)*len(operation.Columns))
+		for _, row := range operation.Values[start:end] {
+			values = append(values, row...)
+		}
+		statements = append(statements, Statement{Query: query, Args: values})
+	}
+	return table, statements, nil
 }
@@ -2,9 +2,13 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/nipunap/sqlite-mcp-server/internal/progress"
 	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
 )
 
@@ -88,6 +92,190 @@ func TestBatchOperations(t *testing.T) {
 		}
 	})
 
+	t.Run("ExecuteBatchProgress", func(t *testing.T) {
+		var mu sync.Mutex
+		var reports []float64
+		tracker := progress.New(func(current, total float64, message string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if total != 4 {
+				t.Errorf("Expected total 4, got %v", total)
+			}
+			reports = append(reports, current)
+			return nil
+		}, nil)
+		ctx := progress.NewContext(context.Background(), tracker)
+
+		operations := make([]BatchOperation, 4)
+		for i := range operations {
+			operations[i] = BatchOperation{Database: "test", Query: "SELECT ?", Args: []interface{}{i}}
+		}
+		manager.ExecuteBatch(ctx, operations)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(reports) != 4 || reports[len(reports)-1] != 4 {
+			t.Errorf("Expected one report per operation ending at 4, got %v", reports)
+		}
+	})
+
+	t.Run("SequentialBatch", func(t *testing.T) {
+		// The select sees the insert before it
+		results, err := manager.ExecuteBatchMode(context.Background(), BatchSequential, []BatchOperation{
+			{Database: "test", Query: "INSERT INTO test (name, value) VALUES (?, ?)", Args: []interface{}{"seq", 5}},
+			{Database: "test", Query: "SELECT value FROM test WHERE name = ?", Args: []interface{}{"seq"}},
+		}, false)
+		if err != nil {
+			t.Fatalf("Sequential batch failed: %v", err)
+		}
+		rows := results[1].Results.([]map[string]interface{})
+		if len(rows) != 1 || rows[0]["value"] != int64(5) {
+			t.Errorf("Expected the inserted row, got %+v", results[1])
+		}
+	})
+
+	t.Run("AtomicBatch", func(t *testing.T) {
+		count := func(name string) int {
+			var n int
+			if err := db.QueryRow("SELECT COUNT(*) FROM test WHERE name = ?", name).Scan(&n); err != nil {
+				t.Fatalf("Failed to count records: %v", err)
+			}
+			return n
+		}
+
+		results, err := manager.ExecuteBatchMode(context.Background(), BatchAtomic, []BatchOperation{
+			{Database: "test", Query: "INSERT INTO test (name, value) VALUES (?, ?)", Args: []interface{}{"atomic", 1}},
+			{Database: "test", Query: "UPDATE test SET value = value + 1 WHERE name = ?", Args: []interface{}{"atomic"}},
+		}, false)
+		if err != nil || !results[0].Success || !results[1].Success {
+			t.Fatalf("Atomic batch failed: %v %+v", err, results)
+		}
+		if count("atomic") != 1 {
+			t.Errorf("Expected the atomic batch committed")
+		}
+
+		results, err = manager.ExecuteBatchMode(context.Background(), BatchAtomic, []BatchOperation{
+			{Database: "test", Query: "INSERT INTO test (name, value) VALUES (?, ?)", Args: []interface{}{"rolled back", 1}},
+			{Database: "test", Query: "INSERT INTO missing VALUES (1)"},
+			{Database: "test", Query: "INSERT INTO test (name, value) VALUES (?, ?)", Args: []interface{}{"rolled back", 2}},
+		}, false)
+		if err != nil {
+			t.Fatalf("Atomic batch returned an error: %v", err)
+		}
+		if results[0].Success || !results[0].RolledBack ||
+			results[1].Success || !results[1].RolledBack || !strings.Contains(results[1].Error, "missing") ||
+			results[2].Success || results[2].RolledBack || !strings.Contains(results[2].Error, "not run") {
+			t.Errorf("Unexpected results of a failed atomic batch: %+v", results)
+		}
+		if count("rolled back") != 0 {
+			t.Errorf("Expected the failed atomic batch rolled back")
+		}
+
+		// A dry run reports what the operations did, then undoes it
+		for _, mode := range []string{BatchSequential, BatchAtomic} {
+			results, err = manager.ExecuteBatchMode(context.Background(), mode, []BatchOperation{
+				{Database: "test", Query: "INSERT INTO test (name, value) VALUES (?, ?)", Args: []interface{}{"dry run", 1}},
+				{Database: "test", Query: "UPDATE test SET value = 2 WHERE name IN (?, ?)", Args: []interface{}{"dry run", "atomic"}},
+			}, true)
+			if err != nil || !results[0].Success || results[0].RowsAffected != 1 || results[1].RowsAffected == 0 {
+				t.Errorf("Unexpected %s dry run results: %v %+v", mode, err, results)
+			}
+			if count("dry run") != 0 {
+				t.Errorf("Expected the %s dry run rolled back", mode)
+			}
+		}
+
+		// A statement ending the batch's transaction is refused before anything runs
+		_, err = manager.ExecuteBatchMode(context.Background(), BatchAtomic, []BatchOperation{
+			{Database: "test", Query: "INSERT INTO test (name, value) VALUES (?, ?)", Args: []interface{}{"committed early", 1}},
+			{Database: "test", Query: "COMMIT"},
+			{Database: "test", Query: "INSERT INTO missing VALUES (1)"},
+		}, false)
+		if !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("Expected a COMMIT operation rejected, got %v", err)
+		}
+		if count("committed early") != 0 {
+			t.Errorf("Expected the refused atomic batch to leave the table unchanged")
+		}
+
+		// Nor can a dry run commit its changes itself
+		var rowsBefore, rowsAfter int
+		if err := db.QueryRow("SELECT COUNT(*) FROM test").Scan(&rowsBefore); err != nil {
+			t.Fatalf("Failed to count records: %v", err)
+		}
+		for _, mode := range []string{BatchParallel, BatchSequential} {
+			results, err = manager.ExecuteBatchMode(context.Background(), mode, []BatchOperation{
+				{Database: "test", Query: "INSERT INTO test (name, value) VALUES ('dry commit', 1); COMMIT"},
+				{Database: "test", Query: "COMMIT"},
+			}, true)
+			if err != nil || results[0].Success || results[1].Success || !strings.Contains(results[1].Error, "COMMIT") {
+				t.Errorf("Expected %s dry run COMMIT operations refused: %v %+v", mode, err, results)
+			}
+			if err := db.QueryRow("SELECT COUNT(*) FROM test").Scan(&rowsAfter); err != nil || rowsAfter != rowsBefore {
+				t.Errorf("Expected the %s dry run to leave %d rows, got %d (err: %v)", mode, rowsBefore, rowsAfter, err)
+			}
+		}
+
+		// Statements changing the shared writer's state are refused, leaving
+		// later writes working
+		for _, query := range []string{
+			"PRAGMA query_only = 1",
+			"PRAGMA foreign_keys = OFF",
+			"ATTACH DATABASE ':memory:' AS other",
+			"VACUUM",
+			"INSERT INTO test (name, value) VALUES ('first', 1); INSERT INTO test (name, value) VALUES ('second', 2)",
+		} {
+			results := manager.ExecuteBatch(context.Background(), []BatchOperation{{Database: "test", Query: query}})
+			if results[0].Success || !strings.Contains(results[0].Error, ErrInvalidOperation.Error()) {
+				t.Errorf("Expected %q refused, got %+v", query, results[0])
+			}
+		}
+		if _, err := manager.ExecuteUpdate(context.Background(), "test", "INSERT INTO test (name, value) VALUES ('after', 1)"); err != nil {
+			t.Errorf("Expected writes to work after the refused operations: %v", err)
+		}
+		if results := manager.ExecuteBatch(context.Background(), []BatchOperation{{Database: "test", Query: "PRAGMA table_info(test)"}}); !results[0].Success {
+			t.Errorf("Expected a pragma that reads allowed: %+v", results[0])
+		}
+
+		_, err = manager.ExecuteBatchMode(context.Background(), BatchAtomic, []BatchOperation{
+			{Database: "test", Query: "SELECT 1"},
+			{Database: "other", Query: "SELECT 1"},
+		}, false)
+		if !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("Expected a cross-database atomic batch rejected, got %v", err)
+		}
+
+		if _, err := manager.ExecuteBatchMode(context.Background(), "eventually", nil, false); !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("Expected an unknown mode rejected, got %v", err)
+		}
+	})
+
+	t.Run("FailureDiscardsConnection", func(t *testing.T) {
+		run := func(query string) BatchResult {
+			t.Helper()
+			return manager.ExecuteBatch(context.Background(), []BatchOperation{{Database: "test", Query: query}})[0]
+		}
+
+		// A temporary table lives as long as the writer's connection
+		if result := run("CREATE TEMP TABLE scratch (x)"); !result.Success {
+			t.Fatalf("CREATE TEMP TABLE failed: %s", result.Error)
+		}
+		if result := run("INSERT INTO temp.scratch VALUES (1)"); !result.Success {
+			t.Fatalf("Expected the writer's connection to be reused: %s", result.Error)
+		}
+
+		// A failed operation closes it, so later requests start afresh
+		if result := run("INSERT INTO missing VALUES (1)"); result.Success {
+			t.Fatal("Expected the insert into a missing table to fail")
+		}
+		if result := run("INSERT INTO temp.scratch VALUES (2)"); result.Success {
+			t.Error("Expected the writer's connection to be replaced after a failure")
+		}
+		if _, err := manager.ExecuteUpdate(context.Background(), "test", "INSERT INTO test (name, value) VALUES ('fresh', 1)"); err != nil {
+			t.Errorf("Write on the new connection failed: %v", err)
+		}
+	})
+
 	t.Run("BulkInsert", func(t *testing.T) {
 		operation := BulkInsertOperation{
 			Database: "test",
@@ -120,6 +308,35 @@ func TestBatchOperations(t *testing.T) {
 		}
 	})
 
+	t.Run("BulkInsertChunks", func(t *testing.T) {
+		// More values than a single statement may bind
+		values := make([][]interface{}, maxBulkVariables)
+		for i := range values {
+			values[i] = []interface{}{"chunk", -1}
+		}
+
+		var reports []float64
+		tracker := progress.New(func(current, total float64, message string) error {
+			reports = append(reports, current)
+			return nil
+		}, nil)
+		rowsAffected, err := manager.BulkInsert(progress.NewContext(context.Background(), tracker), BulkInsertOperation{
+			Database: "test",
+			Table:    "test",
+			Columns:  []string{"name", "value"},
+			Values:   values,
+		})
+		if err != nil {
+			t.Fatalf("BulkInsert failed: %v", err)
+		}
+		if rowsAffected != int64(len(values)) {
+			t.Errorf("Expected %d rows affected, got %d", len(values), rowsAffected)
+		}
+		if len(reports) != 2 || reports[1] != float64(len(values)) {
+			t.Errorf("Expected a progress report per chunk, got %v", reports)
+		}
+	})
+
 	t.Run("ConcurrentBatchOperations", func(t *testing.T) {
 		// Create multiple batch operations
 		batchCount := 5
@@ -28,7 +28,7 @@ Example usage:
 	err = registry.RegisterDatabase(info)
 
 	// Execute a query
-	rows, err := manager.ExecuteQuery("mydb", "SELECT * FROM users WHERE id = ?", 1)
+	rows, err := manager.ExecuteQuery(ctx, "mydb", "SELECT * FROM users WHERE id = ?", 1)
 
 The package also supports batch operations and bulk inserts for efficient data manipulation.
 */
@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Statement is a SQL statement with the values bound to its placeholders
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// RowChange is a row as it was before a write and as it is after it. Before
+// is nil for an inserted row and After for a deleted one.
+type RowChange struct {
+	Before map[string]interface{} `json:"before,omitempty" description:"The row before the write; absent for an inserted row"`
+	After  map[string]interface{} `json:"after,omitempty" description:"The row after the write; absent for a deleted row"`
+}
+
+// Preview is what a write would do to a table
+type Preview struct {
+	RowsAffected int64
+	Changes      []RowChange
+	Truncation
+}
+
+// Preview runs statements that write to t, built without a RETURNING clause,
+// and reports the rows they change, then undoes them. The touched rows are
+// found by their primary key, read after the statements ran and again after
+// they were rolled back. A temporary trigger records the key each updated row
+// had before, so a row whose key changes is shown as the update it is. e must
+// keep to a single connection, such as a transaction. Changes are cut to
+// limits.
+func (t *Table) Preview(ctx context.Context, e Executor, limits Limits, statements ...Statement) (*Preview, error) {
+	key := t.PrimaryKey()
+	returning := make([]string, len(key))
+	for i, col := range key {
+		returning[i] = QuoteIdentifier(col)
+	}
+
+	// A savepoint of its own, so that it cannot meet one of the caller's
+	name := "mcp_dry_run_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	savepoint := QuoteIdentifier(name)
+	if _, err := e.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return nil, translateError(err)
+	}
+	rolledBack := false
+	defer func() {
+		if !rolledBack {
+			e.ExecContext(context.Background(), "ROLLBACK TO "+savepoint)
+		}
+		e.ExecContext(context.Background(), "RELEASE "+savepoint)
+	}()
+
+	// The trigger and its table are dropped with the savepoint
+	updates := "temp." + savepoint
+	oldKey, newKey := make([]string, len(key)), make([]string, len(key))
+	for i, col := range returning {
+		oldKey[i], newKey[i] = "old."+col, "new."+col
+	}
+	for _, setup := range []string{
+		fmt.Sprintf("CREATE TEMP TABLE %s (%s)", savepoint, strings.Join(append(keyColumns("old", len(key)), keyColumns("new", len(key))...), ", ")),
+		fmt.Sprintf("CREATE TEMP TRIGGER %s AFTER UPDATE ON %s BEGIN INSERT INTO %s VALUES (%s, %s); END",
+			savepoint, t.Quoted(), savepoint, strings.Join(oldKey, ", "), strings.Join(newKey, ", ")),
+	} {
+		if _, err := e.ExecContext(ctx, setup); err != nil {
+			return nil, translateError(err)
+		}
+	}
+
+	// The statements report the key of every row they touch
+	var keys [][]interface{}
+	seen := make(map[string]bool)
+	preview := &Preview{}
+	for _, stmt := range statements {
+		rows, err := e.QueryContext(ctx, stmt.Query+" RETURNING "+strings.Join(returning, ", "), stmt.Args...)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		err = EachRowValues(rows, func(values []interface{}) error {
+			preview.RowsAffected++
+			if id := rowKey(values); !seen[id] {
+				seen[id] = true
+				keys = append(keys, values)
+			}
+			return nil
+		})
+		rows.Close()
+		if err != nil {
+			return nil, translateError(err)
+		}
+	}
+
+	// Updated rows are matched with the key they had before the statements
+	origins, err := updatedKeys(ctx, e, updates, len(key))
+	if err != nil {
+		return nil, err
+	}
+	previous := make([][]interface{}, len(keys))
+	for i, k := range keys {
+		previous[i] = k
+		if origin, updated := origins[rowKey(k)]; updated {
+			previous[i] = origin
+		}
+	}
+
+	after, err := t.rowsByKey(ctx, e, keys)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.ExecContext(ctx, "ROLLBACK TO "+savepoint); err != nil {
+		return nil, translateError(err)
+	}
+	rolledBack = true
+	before, err := t.rowsByKey(ctx, e, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	guard := NewRowGuard(Limits{MaxRows: limits.MaxRows, MaxBytes: limits.MaxBytes}, FormatJSON, []string{"before", "after"})
+	preview.Changes = []RowChange{}
+	for i, k := range keys {
+		change := RowChange{Before: before[rowKey(previous[i])], After: after[rowKey(k)]}
+		if change.Before == nil && change.After == nil {
+			continue
+		}
+		if !guard.Truncated && guard.Admit([]interface{}{change.Before, change.After}) {
+			preview.Changes = append(preview.Changes, change)
+		}
+	}
+	if guard.Truncated {
+		total := len(keys)
+		guard.TotalRows = &total
+	}
+	preview.Truncation = guard.Truncation
+	return preview, nil
+}
+
+// keyColumns names the columns of the update log holding the old or new key
+func keyColumns(prefix string, n int) []string {
+	columns := make([]string, n)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("%s_%d", prefix, i)
+	}
+	return columns
+}
+
+// updatedKeys reads the update log of a preview, which holds the old and the
+// new key of each updated row in the order of the updates. It returns the key
+// each updated row had before the first of them, by rowKey of its new key.
+func updatedKeys(ctx context.Context, q Queryer, updates string, n int) (map[string][]interface{}, error) {
+	rows, err := q.QueryContext(ctx, "SELECT * FROM "+updates+" ORDER BY rowid")
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	origins := make(map[string][]interface{})
+	err = EachRowValues(rows, func(values []interface{}) error {
+		old, updated := values[:n], values[n:]
+		origin, seen := origins[rowKey(old)]
+		if !seen {
+			origin = old
+		}
+		origins[rowKey(updated)] = origin
+		return nil
+	})
+	return origins, translateError(err)
+}
+
+// rowsByKey reads the rows of t with the given primary key values, keyed
+// by rowKey. Tables keyed by rowid report it as a column.
+func (t *Table) rowsByKey(ctx context.Context, q Queryer, keys [][]interface{}) (map[string]map[string]interface{}, error) {
+	key := t.PrimaryKey()
+	columns := "*"
+	if len(t.key) == 0 {
+		columns = "rowid, *"
+	}
+	quoted := make([]string, len(key))
+	for i, col := range key {
+		quoted[i] = QuoteIdentifier(col)
+	}
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(key)), ", ") + ")"
+
+	found := make(map[string]map[string]interface{}, len(keys))
+	chunk := maxBulkVariables / len(key)
+	for start := 0; start < len(keys); start += chunk {
+		end := start + chunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+		tuples := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(key))
+		for _, k := range keys[start:end] {
+			tuples = append(tuples, tuple)
+			args = append(args, k...)
+		}
+		query := fmt.Sprintf("SELECT %s, %s FROM %s WHERE (%s) IN (VALUES %s)",
+			strings.Join(quoted, ", "), columns, t.Quoted(), strings.Join(quoted, ", "), strings.Join(tuples, ", "))
+
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		names, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		err = EachRowValues(rows, func(values []interface{}) error {
+			found[rowKey(values[:len(key)])] = RowMap(names[len(key):], values[len(key):])
+			return nil
+		})
+		rows.Close()
+		if err != nil {
+			return nil, translateError(err)
+		}
+	}
+	return found, nil
+}
+
+// rowKey identifies a row by its primary key values
+func rowKey(values []interface{}) string {
+	return fmt.Sprintf("%#v", values)
+}
+
+// Preview runs statements that write to a table of the named database and
+// reports what they would change without changing anything, as Table.Preview
+// does
+func (m *Manager) Preview(ctx context.Context, name string, table *Table, limits Limits, statements ...Statement) (*Preview, error) {
+	if err := m.CheckWritable(name); err != nil {
+		return nil, err
+	}
+	if err := m.checkNoTransaction(name); err != nil {
+		return nil, err
+	}
+
+	db, err := m.getWriter(name)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return table.Preview(ctx, tx, limits, statements...)
+}
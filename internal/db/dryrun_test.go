@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
+)
+
+func TestPreview(t *testing.T) {
+	conn, _ := testutil.CreateTempDB(t)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	testutil.ExecuteSQL(t, conn, `
+		CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT UNIQUE, qty INTEGER);
+		INSERT INTO items (name, qty) VALUES ('a', 1), ('b', 2), ('c', 3);
+		CREATE TABLE log (msg TEXT);
+		INSERT INTO log VALUES ('x'), ('y');
+	`)
+	ctx := context.Background()
+
+	items, err := LoadTable(ctx, conn, "items")
+	if err != nil {
+		t.Fatalf("LoadTable failed: %v", err)
+	}
+	logTable, err := LoadTable(ctx, conn, "log")
+	if err != nil {
+		t.Fatalf("LoadTable failed: %v", err)
+	}
+
+	preview := func(table *Table, limits Limits, build func() (string, []interface{}, error)) *Preview {
+		t.Helper()
+		query, args, err := build()
+		if err != nil {
+			t.Fatalf("Failed to build statement: %v", err)
+		}
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx failed: %v", err)
+		}
+		defer tx.Rollback()
+		p, err := table.Preview(ctx, tx, limits, Statement{Query: query, Args: args})
+		if err != nil {
+			t.Fatalf("Preview of %s failed: %v", query, err)
+		}
+		return p
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		p := preview(items, Limits{}, func() (string, []interface{}, error) {
+			return items.Update(map[string]interface{}{"qty": 0}, Filter{Where: []Condition{{Column: "qty", Op: ">=", Value: 2}}}, false, false)
+		})
+		if p.RowsAffected != 2 || len(p.Changes) != 2 {
+			t.Fatalf("Unexpected preview: %+v", p)
+		}
+		for _, change := range p.Changes {
+			if change.Before["id"] != change.After["id"] || change.Before["qty"] == int64(0) || change.After["qty"] != int64(0) {
+				t.Errorf("Unexpected change: %+v", change)
+			}
+		}
+	})
+
+	t.Run("KeyChange", func(t *testing.T) {
+		p := preview(items, Limits{}, func() (string, []interface{}, error) {
+			return items.Update(map[string]interface{}{"id": 10}, Filter{Where: []Condition{{Column: "name", Value: "b"}}}, false, false)
+		})
+		if len(p.Changes) != 1 || p.Changes[0].Before["id"] != int64(2) || p.Changes[0].After["id"] != int64(10) || p.Changes[0].Before["name"] != "b" {
+			t.Errorf("Expected the key change to show as an update: %+v", p)
+		}
+
+		p = preview(logTable, Limits{}, func() (string, []interface{}, error) {
+			return logTable.Update(map[string]interface{}{"msg": "z"}, Filter{}, true, false)
+		})
+		if len(p.Changes) != 2 || p.Changes[0].Before["msg"] == "z" || p.Changes[0].After["msg"] != "z" {
+			t.Errorf("Unexpected update preview of a rowid table: %+v", p)
+		}
+	})
+
+	t.Run("CallerSavepoint", func(t *testing.T) {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx failed: %v", err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("SAVEPOINT mcp_dry_run"); err != nil {
+			t.Fatalf("SAVEPOINT failed: %v", err)
+		}
+		query, args, _ := items.Delete(Filter{Where: []Condition{{Column: "name", Value: "a"}}}, false, false)
+		if _, err := items.Preview(ctx, tx, Limits{}, Statement{Query: query, Args: args}); err != nil {
+			t.Fatalf("Preview failed: %v", err)
+		}
+		if _, err := tx.Exec("RELEASE mcp_dry_run"); err != nil {
+			t.Errorf("Expected the caller's savepoint to survive the preview: %v", err)
+		}
+	})
+
+	t.Run("InsertAndDelete", func(t *testing.T) {
+		p := preview(items, Limits{}, func() (string, []interface{}, error) {
+			return items.Insert(map[string]interface{}{"name": "d", "qty": 4}, nil, false)
+		})
+		if len(p.Changes) != 1 || p.Changes[0].Before != nil || p.Changes[0].After["name"] != "d" {
+			t.Errorf("Unexpected insert preview: %+v", p)
+		}
+
+		p = preview(logTable, Limits{}, func() (string, []interface{}, error) {
+			return logTable.Delete(Filter{Where: []Condition{{Column: "msg", Value: "y"}}}, false, false)
+		})
+		if len(p.Changes) != 1 || p.Changes[0].After != nil || p.Changes[0].Before["msg"] != "y" || p.Changes[0].Before["rowid"] != int64(2) {
+			t.Errorf("Unexpected delete preview of a rowid table: %+v", p)
+		}
+	})
+
+	t.Run("Upsert", func(t *testing.T) {
+		p := preview(items, Limits{}, func() (string, []interface{}, error) {
+			return items.Upsert(map[string]interface{}{"name": "a", "qty": 10}, []string{"name"}, false)
+		})
+		if len(p.Changes) != 1 || p.Changes[0].Before["qty"] != int64(1) || p.Changes[0].After["qty"] != int64(10) {
+			t.Errorf("Unexpected upsert preview: %+v", p)
+		}
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		p := preview(items, Limits{MaxRows: 1}, func() (string, []interface{}, error) {
+			return items.Delete(Filter{}, true, false)
+		})
+		if p.RowsAffected != 3 || len(p.Changes) != 1 || !p.Truncated || p.Limit != "max_rows" || *p.TotalRows != 3 {
+			t.Errorf("Unexpected truncated preview: %+v", p)
+		}
+	})
+
+	// Nothing was changed
+	var n int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM items WHERE qty = ?", 0).Scan(&n); err != nil || n != 0 {
+		t.Errorf("Expected previews to leave the table unchanged: %v %d", err, n)
+	}
+	if err := conn.QueryRow("SELECT COUNT(*) FROM items").Scan(&n); err != nil || n != 3 {
+		t.Errorf("Expected previews to leave the table unchanged: %v %d", err, n)
+	}
+}
@@ -0,0 +1,294 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result formats
+const (
+	// FormatJSON returns rows as objects keyed by column name
+	FormatJSON = "json"
+	// FormatTable returns rows as arrays in column order, with the columns
+	// described separately and values encoded by EncodeValue
+	FormatTable = "table"
+	// FormatMarkdown renders rows as a Markdown table
+	FormatMarkdown = "markdown"
+	// FormatCSV renders rows as RFC 4180 CSV with a header line
+	FormatCSV = "csv"
+	// FormatNDJSON renders one JSON object per row and line, with values
+	// encoded by EncodeValue
+	FormatNDJSON = "ndjson"
+)
+
+// formatMimeTypes maps every format to the MIME type of its rendering
+var formatMimeTypes = map[string]string{
+	FormatJSON:     "application/json",
+	FormatTable:    "application/json",
+	FormatMarkdown: "text/markdown",
+	FormatCSV:      "text/csv",
+	FormatNDJSON:   "application/x-ndjson",
+}
+
+// ParseFormat validates a result format, defaulting to FormatJSON
+func ParseFormat(format string) (string, error) {
+	if format == "" {
+		return FormatJSON, nil
+	}
+	if _, ok := formatMimeTypes[format]; !ok {
+		return "", fmt.Errorf("unknown result format %q", format)
+	}
+	return format, nil
+}
+
+// IsTextFormat reports whether rows in format are rendered as a single text
+func IsTextFormat(format string) bool {
+	return format == FormatMarkdown || format == FormatCSV || format == FormatNDJSON
+}
+
+// FormatMimeType returns the MIME type of results in format
+func FormatMimeType(format string) string {
+	return formatMimeTypes[format]
+}
+
+// maxSafeInteger is the largest integer a JSON number holds exactly in most clients
+const maxSafeInteger = 1 << 53
+
+// Blob is the tagged encoding of a BLOB value in the table format
+type Blob struct {
+	Type   string `json:"type"`
+	Base64 string `json:"base64"`
+}
+
+// EncodeValue maps a SQLite value onto JSON without losing information:
+// BLOBs become a tagged Blob, integers beyond 2^53 and non-finite floats
+// become strings, and NULL stays null.
+func EncodeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		if v > maxSafeInteger || v < -maxSafeInteger {
+			return strconv.FormatInt(v, 10)
+		}
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	case []byte:
+		return Blob{Type: "blob", Base64: base64.StdEncoding.EncodeToString(v)}
+	}
+	return value
+}
+
+// RowSet collects rows in a result format
+type RowSet struct {
+	format  string
+	columns []string
+	objects []map[string]interface{}
+	table   [][]interface{}
+}
+
+// NewRowSet creates an empty row set for rows with the given column names
+func NewRowSet(format string, columns []string) *RowSet {
+	return &RowSet{format: format, columns: columns}
+}
+
+// Add appends a row given as values in column order
+func (s *RowSet) Add(values []interface{}) {
+	switch {
+	case s.format == FormatJSON:
+		s.objects = append(s.objects, RowMap(s.columns, values))
+	case IsTextFormat(s.format):
+		s.table = append(s.table, values)
+	default:
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			row[i] = EncodeValue(value)
+		}
+		s.table = append(s.table, row)
+	}
+}
+
+// Len returns the number of rows collected
+func (s *RowSet) Len() int {
+	if s.format == FormatJSON {
+		return len(s.objects)
+	}
+	return len(s.table)
+}
+
+// Rows returns the collected rows: []map[string]interface{} for FormatJSON,
+// [][]interface{} for FormatTable and the rendered string for text formats
+func (s *RowSet) Rows() interface{} {
+	switch {
+	case s.format == FormatJSON:
+		if s.objects == nil {
+			return []map[string]interface{}{}
+		}
+		return s.objects
+	case IsTextFormat(s.format):
+		return s.Text()
+	}
+	if s.table == nil {
+		return [][]interface{}{}
+	}
+	return s.table
+}
+
+// Reset drops the collected rows
+func (s *RowSet) Reset() {
+	s.objects, s.table = nil, nil
+}
+
+// Text renders the collected rows in a text format
+func (s *RowSet) Text() string {
+	var buf bytes.Buffer
+	switch s.format {
+	case FormatMarkdown:
+		writeMarkdown(&buf, s.columns, s.table)
+	case FormatCSV:
+		writeCSV(&buf, s.columns, s.table)
+	case FormatNDJSON:
+		writeNDJSON(&buf, s.columns, s.table)
+	}
+	return buf.String()
+}
+
+// writeMarkdown renders a Markdown table. Pipes, backslashes, emphasis
+// markers and HTML are escaped, line breaks become <br> and NULL is shown as
+// *NULL* so it differs from an empty string or the text "*NULL*". BLOBs are
+// shown as SQL hex literals, and text starting like one has its quote escaped.
+func writeMarkdown(buf *bytes.Buffer, columns []string, rows [][]interface{}) {
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = markdownEscape(col)
+	}
+	writeMarkdownRow(buf, cells)
+
+	for i := range cells {
+		cells[i] = "---"
+	}
+	writeMarkdownRow(buf, cells)
+
+	for _, row := range rows {
+		for i, value := range row {
+			switch v := value.(type) {
+			case nil:
+				cells[i] = "*NULL*"
+			case []byte:
+				cells[i] = "X'" + strings.ToUpper(hex.EncodeToString(v)) + "'"
+			default:
+				cells[i] = markdownEscape(textValue(v))
+				if strings.HasPrefix(cells[i], "X'") {
+					cells[i] = `X\'` + cells[i][2:]
+				}
+			}
+		}
+		writeMarkdownRow(buf, cells)
+	}
+}
+
+func writeMarkdownRow(buf *bytes.Buffer, cells []string) {
+	buf.WriteString("|")
+	for _, cell := range cells {
+		buf.WriteString(" ")
+		buf.WriteString(cell)
+		buf.WriteString(" |")
+	}
+	buf.WriteString("\n")
+}
+
+var markdownReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	"&", "&amp;",
+	"<", "&lt;",
+	"|", `\|`,
+	"*", `\*`,
+	"_", `\_`,
+	"\r\n", "<br>",
+	"\n", "<br>",
+	"\r", "<br>",
+)
+
+func markdownEscape(s string) string {
+	return markdownReplacer.Replace(s)
+}
+
+// writeCSV renders CSV with CRLF line endings. Fields holding separators,
+// quotes or line breaks are quoted with doubled quotes. NULL is an empty
+// field while an empty string is "", and BLOBs are base64.
+func writeCSV(buf *bytes.Buffer, columns []string, rows [][]interface{}) {
+	for i, col := range columns {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(csvQuote(col, false))
+	}
+	buf.WriteString("\r\n")
+
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			switch v := value.(type) {
+			case nil:
+			case []byte:
+				buf.WriteString(base64.StdEncoding.EncodeToString(v))
+			case string:
+				buf.WriteString(csvQuote(v, true))
+			default:
+				buf.WriteString(textValue(v))
+			}
+		}
+		buf.WriteString("\r\n")
+	}
+}
+
+// csvQuote quotes a field when needed, and always when it is empty and
+// empty must be told apart from NULL
+func csvQuote(s string, quoteEmpty bool) string {
+	if (s == "" && quoteEmpty) || strings.ContainsAny(s, ",\"\r\n") || strings.TrimSpace(s) != s {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return s
+}
+
+// writeNDJSON renders one JSON object per row. Line breaks inside values are
+// escaped by the JSON encoding. As with FormatJSON, repeated column names
+// keep the last value.
+func writeNDJSON(buf *bytes.Buffer, columns []string, rows [][]interface{}) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	for _, row := range rows {
+		encoded := make([]interface{}, len(row))
+		for i, value := range row {
+			encoded[i] = EncodeValue(value)
+		}
+		// Encoded values always marshal
+		_ = enc.Encode(RowMap(columns, encoded))
+	}
+}
+
+// textValue renders a scalar value as plain text
+func textValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
+)
+
+func TestEncodeValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"null", nil, `null`},
+		{"empty text", "", `""`},
+		{"safe integer", int64(1 << 53), `9007199254740992`},
+		{"large integer", int64(1<<53 + 1), `"9007199254740993"`},
+		{"negative large integer", int64(math.MinInt64), `"-9223372036854775808"`},
+		{"float", 1.5, `1.5`},
+		{"infinity", math.Inf(1), `"+Inf"`},
+		{"blob", []byte{0, 1, 2}, `{"type":"blob","base64":"AAEC"}`},
+		{"empty blob", []byte{}, `{"type":"blob","base64":""}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(EncodeValue(tt.value))
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("EncodeValue(%v) = %s, want %s", tt.value, data, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRowsTable(t *testing.T) {
+	db, _ := testutil.CreateTempDB(t)
+	defer db.Close()
+
+	testutil.ExecuteSQL(t, db, `
+		CREATE TABLE a (id INTEGER PRIMARY KEY, note TEXT, data BLOB);
+		CREATE TABLE b (id INTEGER PRIMARY KEY, a_id INTEGER);
+		INSERT INTO a VALUES (9007199254740993, '', x'cafe'), (2, NULL, NULL);
+		INSERT INTO b VALUES (7, 9007199254740993), (8, 2);
+	`)
+
+	rows, err := db.Query("SELECT a.id, b.id, a.note, a.data FROM a JOIN b ON b.a_id = a.id ORDER BY b.id")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	columns, resultSet, _, err := ReadRows(rows, FormatTable, Limits{})
+	if err != nil {
+		t.Fatalf("ReadRows failed: %v", err)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"columns": columns, "rows": resultSet})
+	want := `{"columns":[{"name":"id","decltype":"INTEGER"},{"name":"id","decltype":"INTEGER"},{"name":"note","decltype":"TEXT"},{"name":"data","decltype":"BLOB"}],` +
+		`"rows":[["9007199254740993",7,"",{"type":"blob","base64":"yv4="}],[2,8,null,null]]}`
+	if string(data) != want {
+		t.Errorf("Unexpected table result\n got %s\nwant %s", data, want)
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected error for an unknown format")
+	}
+}
+
+func TestTextFormats(t *testing.T) {
+	columns := []string{"id", "note, \"quoted\"", "data"}
+	rows := [][]interface{}{
+		{int64(1), "line one\nline two", []byte{0xca, 0xfe}},
+		{int64(2), `a | b \ c`, nil},
+		{int64(3), "", "say \"hi\""},
+		{int64(1<<53 + 1), " padded", 2.5},
+		{int64(4), "*NULL*", nil},
+		{int64(5), "X'CAFE'", "a<br>b & c"},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatMarkdown, "" +
+			"| id | note, \"quoted\" | data |\n" +
+			"| --- | --- | --- |\n" +
+			"| 1 | line one<br>line two | X'CAFE' |\n" +
+			"| 2 | a \\| b \\\\ c | *NULL* |\n" +
+			"| 3 |  | say \"hi\" |\n" +
+			"| 9007199254740993 |  padded | 2.5 |\n" +
+			"| 4 | \\*NULL\\* | *NULL* |\n" +
+			"| 5 | X\\'CAFE' | a&lt;br>b &amp; c |\n"},
+		{FormatCSV, "" +
+			"id,\"note, \"\"quoted\"\"\",data\r\n" +
+			"1,\"line one\nline two\",yv4=\r\n" +
+			"2,a | b \\ c,\r\n" +
+			"3,\"\",\"say \"\"hi\"\"\"\r\n" +
+			"9007199254740993,\" padded\",2.5\r\n" +
+			"4,*NULL*,\r\n" +
+			"5,X'CAFE',a<br>b & c\r\n"},
+		{FormatNDJSON, "" +
+			"{\"data\":{\"type\":\"blob\",\"base64\":\"yv4=\"},\"id\":1,\"note, \\\"quoted\\\"\":\"line one\\nline two\"}\n" +
+			"{\"data\":null,\"id\":2,\"note, \\\"quoted\\\"\":\"a | b \\\\ c\"}\n" +
+			"{\"data\":\"say \\\"hi\\\"\",\"id\":3,\"note, \\\"quoted\\\"\":\"\"}\n" +
+			"{\"data\":2.5,\"id\":\"9007199254740993\",\"note, \\\"quoted\\\"\":\" padded\"}\n" +
+			"{\"data\":null,\"id\":4,\"note, \\\"quoted\\\"\":\"*NULL*\"}\n" +
+			"{\"data\":\"a<br>b & c\",\"id\":5,\"note, \\\"quoted\\\"\":\"X'CAFE'\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			set := NewRowSet(tt.format, columns)
+			for _, row := range rows {
+				set.Add(row)
+			}
+			if got := set.Rows(); got != tt.want {
+				t.Errorf("Unexpected %s rendering\n got %q\nwant %q", tt.format, got, tt.want)
+			}
+		})
+	}
+
+	// The CSV rendering reads back with encoding/csv
+	set := NewRowSet(FormatCSV, columns)
+	for _, row := range rows {
+		set.Add(row)
+	}
+	records, err := csv.NewReader(strings.NewReader(set.Text())).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV does not parse: %v", err)
+	}
+	if len(records) != len(rows)+1 || records[0][1] != `note, "quoted"` || records[1][1] != "line one\nline two" || records[3][2] != `say "hi"` {
+		t.Errorf("Unexpected CSV records %q", records)
+	}
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrTableNotFound is returned when a table does not exist
+var ErrTableNotFound = errors.New("table not found")
+
+// ErrUnknownColumn is returned for a column a table does not have
+var ErrUnknownColumn = errors.New("unknown column")
+
+// QuoteIdentifier quotes a table or column name for use in SQL, escaping embedded double quotes
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Queryer runs queries on a database, a connection or a transaction
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// TableColumn describes a column as reported by PRAGMA table_info
+type TableColumn struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	Default    interface{}
+	PrimaryKey int // position in the primary key starting at 1, or 0
+}
+
+// TableColumns returns the columns of a table in declaration order. The
+// table name is bound as a value, so any name is safe to pass.
+func TableColumns(ctx context.Context, q Queryer, table string) ([]TableColumn, error) {
+	rows, err := q.QueryContext(ctx, `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []TableColumn
+	for rows.Next() {
+		var col TableColumn
+		if err := rows.Scan(&col.Name, &col.Type, &col.NotNull, &col.Default, &col.PrimaryKey); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, table)
+	}
+	return columns, nil
+}
+
+// Table is a table whose columns were read from the schema. It only
+// produces identifiers for names the table actually has, quoted for SQL.
+type Table struct {
+	name    string
+	columns []TableColumn
+	byName  map[string]string
+	key     []string
+}
+
+// NewTable describes the table name with the given columns
+func NewTable(name string, columns []TableColumn) *Table {
+	t := &Table{name: name, columns: columns, byName: make(map[string]string, len(columns))}
+	pk := make([]TableColumn, 0, 1)
+	for _, col := range columns {
+		// SQLite matches identifiers case-insensitively
+		t.byName[strings.ToLower(col.Name)] = col.Name
+		if col.PrimaryKey > 0 {
+			pk = append(pk, col)
+		}
+	}
+	sort.Slice(pk, func(i, j int) bool { return pk[i].PrimaryKey < pk[j].PrimaryKey })
+	for _, col := range pk {
+		t.key = append(t.key, col.Name)
+	}
+	return t
+}
+
+// LoadTable reads the columns of a table from the schema
+func LoadTable(ctx context.Context, q Queryer, name string) (*Table, error) {
+	columns, err := TableColumns(ctx, q, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewTable(name, columns), nil
+}
+
+// Table reads the columns of a table in the named database
+func (m *Manager) Table(ctx context.Context, database, table string) (*Table, error) {
+	conn, err := m.GetConnection(database)
+	if err != nil {
+		return nil, err
+	}
+	return LoadTable(ctx, conn, table)
+}
+
+// Name returns the table name as given
+func (t *Table) Name() string {
+	return t.name
+}
+
+// Quoted returns the table name quoted for SQL
+func (t *Table) Quoted() string {
+	return QuoteIdentifier(t.name)
+}
+
+// Columns returns the columns in declaration order
+func (t *Table) Columns() []TableColumn {
+	return t.columns
+}
+
+// PrimaryKey returns the primary key columns in key order. Tables without
+// a declared primary key are keyed by rowid.
+func (t *Table) PrimaryKey() []string {
+	if len(t.key) == 0 {
+		return []string{"rowid"}
+	}
+	return t.key
+}
+
+// ColumnName returns the name of a column as declared in the schema
+func (t *Table) ColumnName(name string) (string, error) {
+	declared, ok := t.byName[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("%w: table %s has no column %q", ErrUnknownColumn, t.name, name)
+	}
+	return declared, nil
+}
+
+// Column returns a column name quoted for SQL
+func (t *Table) Column(name string) (string, error) {
+	declared, err := t.ColumnName(name)
+	if err != nil {
+		return "", err
+	}
+	return QuoteIdentifier(declared), nil
+}
+
+// QuoteColumns quotes a list of column names, rejecting unknown and repeated ones
+func (t *Table) QuoteColumns(names []string) ([]string, error) {
+	quoted := make([]string, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		declared, err := t.ColumnName(name)
+		if err != nil {
+			return nil, err
+		}
+		if seen[declared] {
+			return nil, fmt.Errorf("column %q is listed twice", name)
+		}
+		seen[declared] = true
+		quoted[i] = QuoteIdentifier(declared)
+	}
+	return quoted, nil
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"users":                   `"users"`,
+		"order items":             `"order items"`,
+		`say "hi"`:                `"say ""hi"""`,
+		`x"; DROP TABLE users;--`: `"x""; DROP TABLE users;--"`,
+	}
+	for name, want := range tests {
+		if got := QuoteIdentifier(name); got != want {
+			t.Errorf("QuoteIdentifier(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestIdentifierInjection(t *testing.T) {
+	db, dbPath := testutil.CreateTempDB(t)
+	defer db.Close()
+
+	testutil.ExecuteSQL(t, db, `
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE "order ""items""" (id INTEGER PRIMARY KEY, "first name" TEXT UNIQUE, qty INTEGER);
+	`)
+
+	registry, err := NewRegistry(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	err = registry.RegisterDatabase(&DatabaseInfo{ID: "test-db", Name: "test", Path: dbPath, Status: "active"})
+	if err != nil {
+		t.Fatalf("Failed to register database: %v", err)
+	}
+
+	manager := NewManager(registry)
+	defer manager.CloseAll()
+	ctx := context.Background()
+
+	table, err := manager.Table(ctx, "test", `order "items"`)
+	if err != nil {
+		t.Fatalf("Failed to load table: %v", err)
+	}
+	if got := table.PrimaryKey(); len(got) != 1 || got[0] != "id" {
+		t.Errorf("Unexpected primary key %v", got)
+	}
+	if col, err := table.Column("FIRST NAME"); err != nil || col != `"first name"` {
+		t.Errorf("Column() = %s, %v; want the declared name quoted", col, err)
+	}
+
+	t.Run("odd names", func(t *testing.T) {
+		rows, err := manager.BulkInsert(ctx, BulkInsertOperation{
+			Database: "test",
+			Table:    `order "items"`,
+			Columns:  []string{"first name", "qty"},
+			Values:   [][]interface{}{{"a", 1}, {"b", 2}},
+		})
+		if err != nil || rows != 2 {
+			t.Fatalf("BulkInsert = %d, %v", rows, err)
+		}
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		operation := BulkInsertOperation{
+			Database:   "test",
+			Table:      `order "items"`,
+			Columns:    []string{"first name", "qty"},
+			Values:     [][]interface{}{{"a", 10}, {"c", 3}},
+			OnConflict: &Conflict{Action: ConflictDoNothing},
+		}
+		if rows, err := manager.BulkInsert(ctx, operation); err != nil || rows != 1 {
+			t.Fatalf("BulkInsert with do_nothing = %d, %v", rows, err)
+		}
+
+		operation.OnConflict = &Conflict{Action: ConflictUpdate, Target: []string{"first name"}}
+		if rows, err := manager.BulkInsert(ctx, operation); err != nil || rows != 2 {
+			t.Fatalf("BulkInsert with update = %d, %v", rows, err)
+		}
+		var qty int
+		if err := db.QueryRow(`SELECT qty FROM "order ""items""" WHERE "first name" = 'a'`).Scan(&qty); err != nil || qty != 10 {
+			t.Errorf("Expected the conflicting row updated to 10, got %d, %v", qty, err)
+		}
+
+		operation.OnConflict = &Conflict{Action: "DO UPDATE SET qty = 0; DROP TABLE users; --"}
+		if _, err := manager.BulkInsert(ctx, operation); err == nil {
+			t.Error("Expected an unknown conflict action to fail")
+		}
+	})
+
+	t.Run("injection", func(t *testing.T) {
+		_, err := manager.BulkInsert(ctx, BulkInsertOperation{
+			Database: "test",
+			Table:    "users (name) VALUES ('x'); DROP TABLE users; --",
+			Columns:  []string{"name"},
+			Values:   [][]interface{}{{"x"}},
+		})
+		if !errors.Is(err, ErrTableNotFound) {
+			t.Errorf("Expected ErrTableNotFound for an injected table name, got %v", err)
+		}
+
+		_, err = manager.BulkInsert(ctx, BulkInsertOperation{
+			Database: "test",
+			Table:    "users",
+			Columns:  []string{"name) VALUES ('x'); DROP TABLE users; --"},
+			Values:   [][]interface{}{{"x"}},
+		})
+		if !errors.Is(err, ErrUnknownColumn) {
+			t.Errorf("Expected ErrUnknownColumn for an injected column name, got %v", err)
+		}
+
+		_, err = manager.BulkInsert(ctx, BulkInsertOperation{
+			Database:   "test",
+			Table:      "users",
+			Columns:    []string{"name"},
+			Values:     [][]interface{}{{"x"}},
+			OnConflict: &Conflict{Action: ConflictUpdate, Target: []string{"id) DO NOTHING; DROP TABLE users; --"}},
+		})
+		if !errors.Is(err, ErrUnknownColumn) {
+			t.Errorf("Expected ErrUnknownColumn for an injected conflict target, got %v", err)
+		}
+
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 0 {
+			t.Errorf("Expected users intact and empty, got %d, %v", count, err)
+		}
+	})
+}
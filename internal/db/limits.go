@@ -0,0 +1,227 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"unicode/utf8"
+)
+
+// Limits bounds the size of a query result. A zero field means no limit.
+type Limits struct {
+	MaxRows      int `json:"max_rows,omitempty"`
+	MaxBytes     int `json:"max_bytes,omitempty"`
+	MaxCellBytes int `json:"max_cell_bytes,omitempty"`
+}
+
+// DefaultLimits apply to every result unless configured otherwise
+var DefaultLimits = Limits{
+	MaxRows:      1000,
+	MaxBytes:     1 << 20,
+	MaxCellBytes: 64 << 10,
+}
+
+// DefaultLimitCeiling is the largest result a call may ask for unless configured otherwise
+var DefaultLimitCeiling = Limits{
+	MaxRows:      100000,
+	MaxBytes:     16 << 20,
+	MaxCellBytes: 1 << 20,
+}
+
+// Override returns l with every non-zero field of o replacing its counterpart
+func (l Limits) Override(o Limits) Limits {
+	if o.MaxRows > 0 {
+		l.MaxRows = o.MaxRows
+	}
+	if o.MaxBytes > 0 {
+		l.MaxBytes = o.MaxBytes
+	}
+	if o.MaxCellBytes > 0 {
+		l.MaxCellBytes = o.MaxCellBytes
+	}
+	return l
+}
+
+// Clamp returns l with every field lowered to the ceiling's, where the ceiling sets one
+func (l Limits) Clamp(ceiling Limits) Limits {
+	clamp := func(v, max int) int {
+		if max > 0 && (v <= 0 || v > max) {
+			return max
+		}
+		return v
+	}
+	return Limits{
+		MaxRows:      clamp(l.MaxRows, ceiling.MaxRows),
+		MaxBytes:     clamp(l.MaxBytes, ceiling.MaxBytes),
+		MaxCellBytes: clamp(l.MaxCellBytes, ceiling.MaxCellBytes),
+	}
+}
+
+// SetLimits configures the default result limits, the ceiling that no
+// database or call may exceed, and per-database defaults keyed by name
+func (m *Manager) SetLimits(defaults, ceiling Limits, databases map[string]Limits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limits = defaults
+	m.ceiling = ceiling
+	m.databaseLimits = databases
+}
+
+// ResultLimits returns the limits for a result read from the named database,
+// with the limits requested by the call applied within the ceiling
+func (m *Manager) ResultLimits(name string, requested Limits) Limits {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.limits.Override(m.databaseLimits[name]).Override(requested).Clamp(m.ceiling)
+}
+
+// Truncation describes how a result was cut to fit its limits
+type Truncation struct {
+	Truncated      bool   `json:"truncated,omitempty"`
+	Limit          string `json:"limit,omitempty"`
+	TotalRows      *int   `json:"total_rows,omitempty"`
+	CellsTruncated int    `json:"cells_truncated,omitempty"`
+}
+
+// RowGuard admits rows into a result until a row or byte limit is reached,
+// shortening oversized cells on the way
+type RowGuard struct {
+	limits   Limits
+	rows     int
+	bytes    int
+	overhead int
+	Truncation
+}
+
+// NewRowGuard creates a guard enforcing limits on rows encoded in format
+// with the given column names
+func NewRowGuard(limits Limits, format string, columns []string) *RowGuard {
+	g := &RowGuard{limits: limits}
+	if format == FormatJSON || format == FormatNDJSON {
+		// Objects repeat every column name in every row
+		for _, col := range columns {
+			g.overhead += len(col) + 3
+		}
+	}
+	return g
+}
+
+// Admit shortens the oversized cells of a row, given as values in column
+// order, and reports whether it fits in the result. The first row is always
+// admitted so that a result can make progress. Once a row is refused the
+// guard records the limit that triggered.
+func (g *RowGuard) Admit(values []interface{}) bool {
+	if g.limits.MaxRows > 0 && g.rows >= g.limits.MaxRows {
+		g.Truncated, g.Limit = true, "max_rows"
+		return false
+	}
+
+	cells := 0
+	if g.limits.MaxCellBytes > 0 {
+		for i, value := range values {
+			if short, cut := truncateCell(value, g.limits.MaxCellBytes); cut {
+				values[i] = short
+				cells++
+			}
+		}
+	}
+
+	if g.limits.MaxBytes > 0 {
+		size := rowSize(values) + g.overhead
+		if g.rows > 0 && g.bytes+size > g.limits.MaxBytes {
+			g.Truncated, g.Limit = true, "max_bytes"
+			return false
+		}
+		g.bytes += size
+	}
+
+	g.rows++
+	g.CellsTruncated += cells
+	return true
+}
+
+// rowSize estimates the bytes a row adds to a JSON response
+func rowSize(values []interface{}) int {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return 0
+	}
+	return len(data) + 1
+}
+
+// truncateCell shortens TEXT and BLOB values longer than max bytes, keeping
+// text valid UTF-8
+func truncateCell(value interface{}, max int) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if len(v) <= max {
+			return v, false
+		}
+		cut := max
+		for cut > 0 && !utf8.RuneStart(v[cut]) {
+			cut--
+		}
+		return v[:cut], true
+	case []byte:
+		if len(v) <= max {
+			return v, false
+		}
+		return v[:max], true
+	}
+	return value, false
+}
+
+// errResultFull stops reading once a guard refuses a row
+var errResultFull = errors.New("result full")
+
+// totalRowsScanLimit bounds how many rows past a truncation are counted to
+// report the total row count
+const totalRowsScanLimit = 10000
+
+// ReadRows reads the remaining rows in a result format, bounded by limits.
+// The rows are returned as described by RowSet.Rows.
+func ReadRows(rows *sql.Rows, format string, limits Limits) ([]Column, interface{}, Truncation, error) {
+	columns, err := ResultColumns(rows)
+	if err != nil {
+		return nil, nil, Truncation{}, err
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+
+	guard := NewRowGuard(limits, format, names)
+	resultSet := NewRowSet(format, names)
+	err = EachRowValues(rows, func(values []interface{}) error {
+		if !guard.Admit(values) {
+			return errResultFull
+		}
+		resultSet.Add(values)
+		return nil
+	})
+	if err == errResultFull {
+		guard.CountTotal(rows)
+	} else if err != nil {
+		return nil, nil, Truncation{}, err
+	}
+
+	return columns, resultSet.Rows(), guard.Truncation, nil
+}
+
+// CountTotal records the total row count of a truncated result by counting
+// the rows left after the refused one, unless there are too many to count
+// cheaply
+func (g *RowGuard) CountTotal(rows *sql.Rows) {
+	remaining := 0
+	for rows.Next() {
+		if remaining == totalRowsScanLimit {
+			return
+		}
+		remaining++
+	}
+	if rows.Err() != nil {
+		return
+	}
+	total := g.rows + 1 + remaining
+	g.TotalRows = &total
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
+)
+
+func TestResultLimits(t *testing.T) {
+	registry, err := NewRegistry(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	manager := NewManager(registry)
+	manager.SetLimits(
+		Limits{MaxRows: 100, MaxBytes: 1000, MaxCellBytes: 10},
+		Limits{MaxRows: 500, MaxBytes: 5000},
+		map[string]Limits{"big": {MaxRows: 400}},
+	)
+
+	tests := []struct {
+		name      string
+		database  string
+		requested Limits
+		want      Limits
+	}{
+		{"defaults", "other", Limits{}, Limits{MaxRows: 100, MaxBytes: 1000, MaxCellBytes: 10}},
+		{"per database", "big", Limits{}, Limits{MaxRows: 400, MaxBytes: 1000, MaxCellBytes: 10}},
+		{"per call", "big", Limits{MaxRows: 50, MaxCellBytes: 20}, Limits{MaxRows: 50, MaxBytes: 1000, MaxCellBytes: 20}},
+		{"clamped to ceiling", "other", Limits{MaxRows: 10000, MaxBytes: 10000}, Limits{MaxRows: 500, MaxBytes: 5000, MaxCellBytes: 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := manager.ResultLimits(tt.database, tt.requested); got != tt.want {
+				t.Errorf("ResultLimits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRows(t *testing.T) {
+	db, _ := testutil.CreateTempDB(t)
+	defer db.Close()
+
+	testutil.ExecuteSQL(t, db, `
+		CREATE TABLE items (id INTEGER PRIMARY KEY, body TEXT);
+		WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 50)
+		INSERT INTO items (id, body) SELECT x, printf('%.*c', 40, 'x') FROM c;
+	`)
+
+	tests := []struct {
+		name      string
+		limits    Limits
+		rows      int
+		limit     string
+		totalRows int
+		cells     int
+	}{
+		{"unlimited", Limits{}, 50, "", 0, 0},
+		{"max rows", Limits{MaxRows: 10}, 10, "max_rows", 50, 0},
+		{"max bytes", Limits{MaxBytes: 200}, 3, "max_bytes", 50, 0},
+		{"max cell bytes", Limits{MaxRows: 5, MaxCellBytes: 8}, 5, "max_rows", 50, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := db.Query("SELECT id, body FROM items ORDER BY id")
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			defer rows.Close()
+
+			columns, resultSet, truncation, err := ReadRows(rows, FormatJSON, tt.limits)
+			if err != nil {
+				t.Fatalf("ReadRows failed: %v", err)
+			}
+			result := resultSet.([]map[string]interface{})
+			if len(columns) != 2 || len(result) != tt.rows {
+				t.Errorf("Expected %d rows of 2 columns, got %d rows of %v", tt.rows, len(result), columns)
+			}
+			if truncation.Truncated != (tt.limit != "") || truncation.Limit != tt.limit {
+				t.Errorf("Expected truncation by %q, got %+v", tt.limit, truncation)
+			}
+			if tt.totalRows > 0 && (truncation.TotalRows == nil || *truncation.TotalRows != tt.totalRows) {
+				t.Errorf("Expected total_rows %d, got %v", tt.totalRows, truncation.TotalRows)
+			}
+			if truncation.CellsTruncated != tt.cells {
+				t.Errorf("Expected %d truncated cells, got %d", tt.cells, truncation.CellsTruncated)
+			}
+			if tt.cells > 0 && result[0]["body"] != strings.Repeat("x", 8) {
+				t.Errorf("Expected body shortened to 8 bytes, got %q", result[0]["body"])
+			}
+		})
+	}
+
+	t.Run("UTF-8", func(t *testing.T) {
+		short, cut := truncateCell("héllo", 2)
+		if !cut || short != "h" {
+			t.Errorf("Expected cut before the multi-byte rune, got %q", short)
+		}
+	})
+}
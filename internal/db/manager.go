@@ -1,46 +1,119 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/mattn/go-sqlite3"
 )
 
+// ErrReadOnly is returned when a write is attempted against a database registered as readonly
+var ErrReadOnly = errors.New("database is read-only")
+
 type Manager struct {
 	Registry    *Registry // Exported for API handlers
-	connections map[string]*sql.DB
+	connections map[string]*connection
 	mu          sync.RWMutex
+
+	// Result limits, see SetLimits
+	limits         Limits
+	ceiling        Limits
+	databaseLimits map[string]Limits
+
+	// Open transactions by handle and by database, see BeginTransaction
+	txMu                 sync.Mutex
+	transactions         map[string]*Transaction
+	databaseTransactions map[string]*Transaction
+	txIdleTimeout        time.Duration
+
+	// Options of databases that leave them unset, see SetConnectionDefaults
+	connectionDefaults ConnectionOptions
+}
+
+// DefaultReadConnections is the number of connections that read a database concurrently
+const DefaultReadConnections = 4
+
+// connection is an open database together with the registry entry it was
+// opened from. Reads go through a pool of query-only connections, while
+// writes share a single connection since SQLite allows one writer at a time.
+type connection struct {
+	reader  *sql.DB
+	writer  *sql.DB
+	info    *DatabaseInfo
+	options ConnectionOptions
 }
 
 func NewManager(registry *Registry) *Manager {
 	return &Manager{
 		Registry:    registry,
-		connections: make(map[string]*sql.DB),
+		connections: make(map[string]*connection),
+		limits:      DefaultLimits,
+		ceiling:     DefaultLimitCeiling,
+
+		transactions:         make(map[string]*Transaction),
+		databaseTransactions: make(map[string]*Transaction),
+		txIdleTimeout:        DefaultTransactionIdleTimeout,
+
+		connectionDefaults: DefaultConnectionOptions,
 	}
 }
 
+// GetConnection returns the pool reading the named database. Its connections
+// are query-only; writes go through the Execute methods.
 func (m *Manager) GetConnection(name string) (*sql.DB, error) {
+	conn, err := m.getConnection(name)
+	if err != nil {
+		return nil, err
+	}
+	return conn.reader, nil
+}
+
+// getWriter returns the connection writing the named database
+func (m *Manager) getWriter(name string) (*sql.DB, error) {
+	conn, err := m.getConnection(name)
+	if err != nil {
+		return nil, err
+	}
+	return conn.writer, nil
+}
+
+// CheckWritable returns ErrReadOnly if the database is registered as readonly
+func (m *Manager) CheckWritable(name string) error {
+	conn, err := m.getConnection(name)
+	if err != nil {
+		return err
+	}
+	if conn.info.ReadOnly {
+		return fmt.Errorf("%w: %s", ErrReadOnly, name)
+	}
+	return nil
+}
+
+func (m *Manager) getConnection(name string) (*connection, error) {
 	m.mu.RLock()
-	db, exists := m.connections[name]
+	conn, exists := m.connections[name]
 	m.mu.RUnlock()
 
 	if exists {
-		return db, nil
+		return conn, nil
 	}
 
 	return m.openConnection(name)
 }
 
-func (m *Manager) openConnection(name string) (*sql.DB, error) {
+func (m *Manager) openConnection(name string) (*connection, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Double-check after acquiring lock
-	if db, exists := m.connections[name]; exists {
-		return db, nil
+	if conn, exists := m.connections[name]; exists {
+		return conn, nil
 	}
 
 	info, err := m.Registry.GetDatabase(name)
@@ -52,45 +125,74 @@ func (m *Manager) openConnection(name string) (*sql.DB, error) {
 		return nil, errors.New("database path must be absolute")
 	}
 
-	db, err := sql.Open("sqlite3", info.Path)
-	if err != nil {
+	options := m.connectionDefaults.Override(info.Options)
+	writer := openDatabase(info, options, false)
+	writer.SetMaxOpenConns(1) // SQLite supports only one writer
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(time.Hour)
+
+	// Connecting the writer first sets the journal mode, WAL by default, so
+	// that readers do not block on it or on each other
+	if err := writer.Ping(); err != nil {
+		writer.Close()
 		return nil, err
 	}
 
-	// Configure connection
-	db.SetMaxOpenConns(1) // SQLite supports only one writer
-	db.SetMaxIdleConns(1)
-	db.SetConnMaxLifetime(time.Hour)
+	reader := openDatabase(info, options, true)
+	reader.SetMaxOpenConns(DefaultReadConnections)
+	reader.SetMaxIdleConns(DefaultReadConnections)
+	reader.SetConnMaxLifetime(time.Hour)
 
-	m.connections[name] = db
+	conn := &connection{reader: reader, writer: writer, info: info, options: options}
+	m.connections[name] = conn
 
 	// Update last accessed time
 	if err := m.Registry.UpdateLastAccessed(info.ID); err != nil {
 		// Log error but don't fail the connection
-		fmt.Printf("Error updating last accessed time: %v\n", err)
+		log.Printf("Error updating last accessed time: %v", err)
 	}
 
-	return db, nil
+	return conn, nil
+}
+
+// translateError maps SQLite errors to the package's sentinel errors
+func translateError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrReadonly {
+		return fmt.Errorf("%w: %v", ErrReadOnly, err)
+	}
+	return err
 }
 
 func (m *Manager) CloseConnection(name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if db, exists := m.connections[name]; exists {
+	if conn, exists := m.connections[name]; exists {
 		delete(m.connections, name)
-		return db.Close()
+		return conn.close()
 	}
 	return nil
 }
 
+// close closes both the readers and the writer of a database
+func (c *connection) close() error {
+	readerErr := c.reader.Close()
+	if err := c.writer.Close(); err != nil {
+		return err
+	}
+	return readerErr
+}
+
 func (m *Manager) CloseAll() error {
+	m.rollbackTransactions()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	var lastErr error
-	for name, db := range m.connections {
-		if err := db.Close(); err != nil {
+	for name, conn := range m.connections {
+		if err := conn.close(); err != nil {
 			lastErr = err
 		}
 		delete(m.connections, name)
@@ -98,20 +200,32 @@ func (m *Manager) CloseAll() error {
 	return lastErr
 }
 
-func (m *Manager) ExecuteQuery(name string, query string, args ...interface{}) (*sql.Rows, error) {
+// ExecuteQuery runs a query on the named database. Canceling ctx interrupts
+// the statement inside SQLite.
+func (m *Manager) ExecuteQuery(ctx context.Context, name string, query string, args ...interface{}) (*sql.Rows, error) {
 	db, err := m.GetConnection(name)
 	if err != nil {
 		return nil, err
 	}
 
-	return db.Query(query, args...)
+	return db.QueryContext(ctx, query, args...)
 }
 
-func (m *Manager) ExecuteUpdate(name string, query string, args ...interface{}) (sql.Result, error) {
-	db, err := m.GetConnection(name)
+// ExecuteUpdate runs a statement that modifies the named database. Canceling
+// ctx interrupts the statement inside SQLite.
+func (m *Manager) ExecuteUpdate(ctx context.Context, name string, query string, args ...interface{}) (sql.Result, error) {
+	if err := m.CheckWritable(name); err != nil {
+		return nil, err
+	}
+	if err := m.checkNoTransaction(name); err != nil {
+		return nil, err
+	}
+
+	db, err := m.getWriter(name)
 	if err != nil {
 		return nil, err
 	}
 
-	return db.Exec(query, args...)
+	result, err := db.ExecContext(ctx, query, args...)
+	return result, translateError(err)
 }
@@ -0,0 +1,258 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
+)
+
+func TestReadOnlyDatabase(t *testing.T) {
+	db, dbPath := testutil.CreateTempDB(t)
+	testutil.ExecuteSQL(t, db, `
+		CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO test (name) VALUES ('existing');
+	`)
+	db.Close()
+
+	registry, err := NewRegistry(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	err = registry.RegisterDatabase(&DatabaseInfo{
+		ID:       "readonly-db",
+		Name:     "readonly",
+		Path:     dbPath,
+		ReadOnly: true,
+		Owner:    "test",
+		Status:   "active",
+	})
+	if err != nil {
+		t.Fatalf("Failed to register database: %v", err)
+	}
+
+	manager := NewManager(registry)
+	defer manager.CloseAll()
+
+	t.Run("ReadsSucceed", func(t *testing.T) {
+		rows, err := manager.ExecuteQuery(context.Background(), "readonly", "SELECT name FROM test")
+		if err != nil {
+			t.Fatalf("ExecuteQuery failed: %v", err)
+		}
+		_, result, err := ScanRows(rows)
+		rows.Close()
+		if err != nil || len(result) != 1 {
+			t.Errorf("Expected 1 row, got %d (err: %v)", len(result), err)
+		}
+	})
+
+	t.Run("CheckWritable", func(t *testing.T) {
+		if err := manager.CheckWritable("readonly"); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Expected ErrReadOnly, got %v", err)
+		}
+	})
+
+	t.Run("ExecuteUpdate", func(t *testing.T) {
+		_, err := manager.ExecuteUpdate(context.Background(), "readonly", "INSERT INTO test (name) VALUES (?)", "new")
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Expected ErrReadOnly, got %v", err)
+		}
+	})
+
+	t.Run("BulkInsert", func(t *testing.T) {
+		_, err := manager.BulkInsert(context.Background(), BulkInsertOperation{
+			Database: "readonly",
+			Table:    "test",
+			Columns:  []string{"name"},
+			Values:   [][]interface{}{{"bulk"}},
+		})
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Expected ErrReadOnly, got %v", err)
+		}
+	})
+
+	t.Run("ExecuteBatch", func(t *testing.T) {
+		results := manager.ExecuteBatch(context.Background(), []BatchOperation{
+			{Database: "readonly", Query: "INSERT INTO test (name) VALUES (?)", Args: []interface{}{"batch"}},
+			{Database: "readonly", Query: "SELECT * FROM test"},
+		})
+		if results[0].Success || !strings.Contains(results[0].Error, ErrReadOnly.Error()) {
+			t.Errorf("Expected read-only failure for insert, got %+v", results[0])
+		}
+		if !results[1].Success {
+			t.Errorf("Expected select to succeed, got %s", results[1].Error)
+		}
+	})
+
+	t.Run("ConnectionIsReadOnly", func(t *testing.T) {
+		// Bypass the manager's checks: the connections themselves must refuse writes
+		if _, err := manager.GetConnection("readonly"); err != nil {
+			t.Fatalf("Failed to get connection: %v", err)
+		}
+		conn := manager.connections["readonly"]
+		if _, err := conn.writer.Exec("DELETE FROM test"); err == nil {
+			t.Error("Expected write on readonly connection to fail")
+		}
+		if _, err := conn.reader.Exec("DELETE FROM test"); err == nil {
+			t.Error("Expected write on reader connection to fail")
+		}
+	})
+
+	var count int
+	if err := manager.connections["readonly"].reader.QueryRow("SELECT COUNT(*) FROM test").Scan(&count); err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected readonly database to be unchanged, got %d rows", count)
+	}
+}
+
+func TestReaderPool(t *testing.T) {
+	manager := setupBenchmarkManager(t, 100)
+	defer manager.CloseAll()
+	ctx := context.Background()
+
+	readers, err := manager.GetConnection("bench")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	var mode string
+	if err := readers.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("Expected WAL mode, got %q (err: %v)", mode, err)
+	}
+	if _, err := readers.Exec("DELETE FROM items"); err == nil {
+		t.Error("Expected the reader pool to refuse writes")
+	}
+
+	// A pragma sent down the read path cannot turn off query_only on one
+	// reader for the requests that get it later
+	for _, pragma := range []string{"PRAGMA query_only(0)", "PRAGMA query_only = 0", "PRAGMA main.query_only(false)"} {
+		if _, err := manager.VerifyReadOnly(ctx, "bench", pragma); !errors.Is(err, ErrNotReadOnly) {
+			t.Errorf("Expected %q to be refused, got %v", pragma, err)
+		}
+		if readsOnly(ctx, readers, pragma) {
+			t.Errorf("Expected %q to count as a write", pragma)
+		}
+	}
+	conns := make([]*sql.Conn, DefaultReadConnections)
+	for i := range conns {
+		if conns[i], err = readers.Conn(ctx); err != nil {
+			t.Fatalf("Conn failed: %v", err)
+		}
+		if _, err := conns[i].ExecContext(ctx, "INSERT INTO items (value) VALUES (1)"); err == nil {
+			t.Errorf("Expected reader %d to refuse writes", i)
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	// A read holding its connection neither blocks another read nor a write
+	held, err := readers.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	defer held.Rollback()
+	var n int
+	if err := held.QueryRow("SELECT COUNT(*) FROM items").Scan(&n); err != nil || n != 100 {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := readers.QueryRowContext(readCtx, "SELECT COUNT(*) FROM items").Scan(&n); err != nil {
+		t.Errorf("Concurrent read blocked: %v", err)
+	}
+	if _, err := manager.ExecuteUpdate(readCtx, "bench", "INSERT INTO items (value) VALUES (1)"); err != nil {
+		t.Errorf("Write during a read failed: %v", err)
+	}
+
+	// The held read keeps its snapshot while new reads see the write
+	if err := held.QueryRow("SELECT COUNT(*) FROM items").Scan(&n); err != nil || n != 100 {
+		t.Errorf("Expected the held read to see 100 rows, got %d (err: %v)", n, err)
+	}
+	if err := readers.QueryRow("SELECT COUNT(*) FROM items").Scan(&n); err != nil || n != 101 {
+		t.Errorf("Expected a new read to see 101 rows, got %d (err: %v)", n, err)
+	}
+}
+
+// setupBenchmarkManager registers a database named bench holding rows items
+func setupBenchmarkManager(tb testing.TB, rows int) *Manager {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "bench.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		tb.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`
+		CREATE TABLE items (id INTEGER PRIMARY KEY, value INTEGER);
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?)
+		INSERT INTO items (value) SELECT i % 97 FROM n;
+	`, rows); err != nil {
+		tb.Fatalf("Failed to fill database: %v", err)
+	}
+
+	registry, err := NewRegistry(":memory:")
+	if err != nil {
+		tb.Fatalf("Failed to create registry: %v", err)
+	}
+	tb.Cleanup(func() { registry.Close() })
+	if err := registry.RegisterDatabase(&DatabaseInfo{ID: "bench-db", Name: "bench", Path: path, Status: "active"}); err != nil {
+		tb.Fatalf("Failed to register database: %v", err)
+	}
+	return NewManager(registry)
+}
+
+// BenchmarkConcurrentReads compares parallel reads through a single shared
+// connection, as databases were opened before, with the reader pool. The
+// query is CPU-bound so the pool's readers can run on separate cores; the
+// gain grows with GOMAXPROCS up to DefaultReadConnections.
+func BenchmarkConcurrentReads(b *testing.B) {
+	const query = `SELECT SUM(a.value * b.value % 13) FROM items a JOIN items b ON b.id = a.id % 500 + 1`
+
+	manager := setupBenchmarkManager(b, 20000)
+	defer manager.CloseAll()
+	readers, err := manager.GetConnection("bench")
+	if err != nil {
+		b.Fatalf("GetConnection failed: %v", err)
+	}
+	info, err := manager.Registry.GetDatabase("bench")
+	if err != nil {
+		b.Fatalf("GetDatabase failed: %v", err)
+	}
+	single := openDatabase(info, DefaultConnectionOptions, false)
+	defer single.Close()
+	single.SetMaxOpenConns(1)
+
+	for _, bench := range []struct {
+		name string
+		db   *sql.DB
+	}{
+		{"SingleConnection", single},
+		{"ReaderPool", readers},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.SetParallelism(DefaultReadConnections)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					rows, err := bench.db.Query(query)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					for rows.Next() {
+					}
+					rows.Close()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ConnectionOptions are the SQLite settings a database is opened with. An
+// unset field inherits the server-wide default.
+type ConnectionOptions struct {
+	JournalMode   string `json:"journal_mode,omitempty" enum:"DELETE,TRUNCATE,PERSIST,MEMORY,WAL,OFF" description:"Journal mode; readers only run alongside a write in WAL mode"`
+	BusyTimeoutMS *int   `json:"busy_timeout_ms,omitempty" description:"How long a statement waits for a lock before failing, in milliseconds"`
+	ForeignKeys   *bool  `json:"foreign_keys,omitempty" description:"Enforce foreign key constraints"`
+	Synchronous   string `json:"synchronous,omitempty" enum:"OFF,NORMAL,FULL,EXTRA" description:"How often SQLite waits for writes to reach the disk"`
+	CacheSize     *int   `json:"cache_size,omitempty" description:"Page cache size per connection in pages, or in KiB when negative"`
+	TempStore     string `json:"temp_store,omitempty" enum:"DEFAULT,FILE,MEMORY" description:"Where temporary tables and indexes are kept"`
+	MmapSize      *int64 `json:"mmap_size,omitempty" description:"Bytes of the file to access through memory mapping, 0 disables it"`
+}
+
+// DefaultConnectionOptions apply to every database unless configured otherwise
+var DefaultConnectionOptions = ConnectionOptions{
+	JournalMode:   "WAL",
+	BusyTimeoutMS: func() *int { ms := 5000; return &ms }(),
+	ForeignKeys:   func() *bool { on := true; return &on }(),
+}
+
+var (
+	journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	syncModes    = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+	tempStores   = []string{"DEFAULT", "FILE", "MEMORY"}
+)
+
+// Override returns o with every set field of c replacing its counterpart
+func (o ConnectionOptions) Override(c ConnectionOptions) ConnectionOptions {
+	if c.JournalMode != "" {
+		o.JournalMode = c.JournalMode
+	}
+	if c.BusyTimeoutMS != nil {
+		o.BusyTimeoutMS = c.BusyTimeoutMS
+	}
+	if c.ForeignKeys != nil {
+		o.ForeignKeys = c.ForeignKeys
+	}
+	if c.Synchronous != "" {
+		o.Synchronous = c.Synchronous
+	}
+	if c.CacheSize != nil {
+		o.CacheSize = c.CacheSize
+	}
+	if c.TempStore != "" {
+		o.TempStore = c.TempStore
+	}
+	if c.MmapSize != nil {
+		o.MmapSize = c.MmapSize
+	}
+	return o
+}
+
+// Validate checks every set field and spells the named modes in upper case
+func (o *ConnectionOptions) Validate() error {
+	var err error
+	if o.JournalMode, err = optionValue("journal_mode", o.JournalMode, journalModes); err != nil {
+		return err
+	}
+	if o.Synchronous, err = optionValue("synchronous", o.Synchronous, syncModes); err != nil {
+		return err
+	}
+	if o.TempStore, err = optionValue("temp_store", o.TempStore, tempStores); err != nil {
+		return err
+	}
+	if o.BusyTimeoutMS != nil && *o.BusyTimeoutMS < 0 {
+		return errors.New("busy_timeout_ms must not be negative")
+	}
+	if o.MmapSize != nil && *o.MmapSize < 0 {
+		return errors.New("mmap_size must not be negative")
+	}
+	return nil
+}
+
+// optionValue returns value in upper case if it is one of allowed or empty
+func optionValue(name, value string, allowed []string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	value = strings.ToUpper(value)
+	for _, a := range allowed {
+		if value == a {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%s must be one of %s", name, strings.Join(allowed, ", "))
+}
+
+// connectionDSN builds the data source name for a registered database with
+// the options the driver understands in it. Readonly databases are opened
+// with mode=ro so SQLite itself refuses writes, and keep the journal mode of
+// the file. Query-only connections refuse writes as well.
+func connectionDSN(info *DatabaseInfo, options ConnectionOptions, queryOnly bool) string {
+	params := url.Values{}
+	if info.ReadOnly {
+		params.Set("mode", "ro")
+	} else if options.JournalMode != "" {
+		params.Set("_journal_mode", options.JournalMode)
+	}
+	if options.BusyTimeoutMS != nil {
+		params.Set("_busy_timeout", strconv.Itoa(*options.BusyTimeoutMS))
+	}
+	if options.ForeignKeys != nil {
+		params.Set("_foreign_keys", strconv.FormatBool(*options.ForeignKeys))
+	}
+	if options.Synchronous != "" {
+		params.Set("_synchronous", options.Synchronous)
+	}
+	if options.CacheSize != nil {
+		params.Set("_cache_size", strconv.Itoa(*options.CacheSize))
+	}
+	if queryOnly {
+		params.Set("_query_only", "1")
+	}
+	fileURI := url.URL{Scheme: "file", Path: info.Path, RawQuery: params.Encode()}
+	return fileURI.String()
+}
+
+// openDatabase opens a registered database with options. The settings the
+// data source name cannot carry are applied to each new connection.
+func openDatabase(info *DatabaseInfo, options ConnectionOptions, queryOnly bool) *sql.DB {
+	var pragmas []string
+	if options.TempStore != "" {
+		pragmas = append(pragmas, "PRAGMA temp_store = "+options.TempStore)
+	}
+	if options.MmapSize != nil {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA mmap_size = %d", *options.MmapSize))
+	}
+
+	return sql.OpenDB(&connector{
+		dsn: connectionDSN(info, options, queryOnly),
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, pragma := range pragmas {
+					if _, err := conn.Exec(pragma, nil); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	})
+}
+
+// connector opens connections to one data source with a configured driver
+type connector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// SetConnectionDefaults configures the options of databases whose registry
+// entry leaves them unset. It applies to databases opened afterwards.
+func (m *Manager) SetConnectionDefaults(defaults ConnectionOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connectionDefaults = DefaultConnectionOptions.Override(defaults)
+}
+
+// ConnectionOptions returns the options a registered database is opened
+// with: its own options over the server-wide defaults
+func (m *Manager) ConnectionOptions(info *DatabaseInfo) ConnectionOptions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.connectionDefaults.Override(info.Options)
+}
+
+// ListDatabases lists the registered databases, each with the options it is
+// opened with in place of those stored for it
+func (m *Manager) ListDatabases() ([]DatabaseInfo, error) {
+	databases, err := m.Registry.ListDatabases()
+	if err != nil {
+		return nil, err
+	}
+	for i := range databases {
+		databases[i].Options = m.ConnectionOptions(&databases[i])
+	}
+	return databases, nil
+}
+
+// SetConnectionOptions changes the options stored for the named database,
+// replacing those set in options, or all of them when reset is true. The
+// database's connections are retired so that they reopen with the new options.
+// It returns the options the database is now opened with.
+func (m *Manager) SetConnectionOptions(ctx context.Context, name string, options ConnectionOptions, reset bool) (ConnectionOptions, error) {
+	if err := options.Validate(); err != nil {
+		return ConnectionOptions{}, err
+	}
+
+	// No transaction may begin on the old options until the new ones are in place
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	if err := m.transactionActive(name); err != nil {
+		return ConnectionOptions{}, err
+	}
+	info, err := m.Registry.GetDatabase(name)
+	if err != nil {
+		return ConnectionOptions{}, err
+	}
+
+	if !reset {
+		options = info.Options.Override(options)
+	}
+	updated := *info
+	updated.Options = options
+	effective := m.ConnectionOptions(&updated)
+
+	// Try the options before storing them, so a database SQLite cannot open
+	// with them keeps working with the old ones
+	trial := openDatabase(&updated, effective, false)
+	err = trial.PingContext(ctx)
+	trial.Close()
+	if err != nil {
+		return ConnectionOptions{}, fmt.Errorf("open with new options: %w", err)
+	}
+
+	if err := m.Registry.SetConnectionOptions(info.ID, options); err != nil {
+		return ConnectionOptions{}, err
+	}
+
+	m.mu.Lock()
+	old, exists := m.connections[name]
+	delete(m.connections, name)
+	m.mu.Unlock()
+	if exists {
+		old.retire()
+	}
+	return effective, nil
+}
+
+// retiredConnectionLifetime is how long the pools of a retired connection stay
+// open for the requests that fetched them before it was replaced
+const retiredConnectionLifetime = time.Minute
+
+// retire closes a connection that requests may still be using. Each of its
+// connections closes once it goes back to its pool, and the pools themselves
+// after retiredConnectionLifetime.
+func (c *connection) retire() {
+	c.reader.SetMaxIdleConns(0)
+	c.writer.SetMaxIdleConns(0)
+	time.AfterFunc(retiredConnectionLifetime, func() { c.close() })
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
+)
+
+func TestConnectionOptions(t *testing.T) {
+	conn, dbPath := testutil.CreateTempDB(t)
+	testutil.ExecuteSQL(t, conn, `CREATE TABLE test (id INTEGER PRIMARY KEY)`)
+	conn.Close()
+
+	registry, err := NewRegistry(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+	if err := registry.RegisterDatabase(&DatabaseInfo{
+		ID: "test-db", Name: "test", Path: dbPath, Status: "active",
+		Options: ConnectionOptions{Synchronous: "OFF"},
+	}); err != nil {
+		t.Fatalf("Failed to register database: %v", err)
+	}
+
+	manager := NewManager(registry)
+	defer manager.CloseAll()
+	cacheSize := -4000
+	manager.SetConnectionDefaults(ConnectionOptions{CacheSize: &cacheSize})
+	ctx := context.Background()
+
+	// pragmas reads settings from both the readers and the writer
+	pragmas := func(names ...string) map[string]interface{} {
+		t.Helper()
+		values := make(map[string]interface{})
+		for _, getDB := range []func(string) (*sql.DB, error){manager.GetConnection, manager.getWriter} {
+			db, err := getDB("test")
+			if err != nil {
+				t.Fatalf("Failed to get connection: %v", err)
+			}
+			for _, name := range names {
+				var value interface{}
+				if err := db.QueryRow("PRAGMA " + name).Scan(&value); err != nil {
+					t.Fatalf("PRAGMA %s failed: %v", name, err)
+				}
+				if previous, seen := values[name]; seen && fmt.Sprint(previous) != fmt.Sprint(value) {
+					t.Errorf("PRAGMA %s differs between readers (%v) and writer (%v)", name, previous, value)
+				}
+				values[name] = fmt.Sprint(value)
+			}
+		}
+		return values
+	}
+	expect := func(want map[string]interface{}) {
+		t.Helper()
+		names := make([]string, 0, len(want))
+		for name := range want {
+			names = append(names, name)
+		}
+		got := pragmas(names...)
+		for name, value := range want {
+			if got[name] != value {
+				t.Errorf("PRAGMA %s = %v, want %v", name, got[name], value)
+			}
+		}
+	}
+
+	// Stored options over the configured defaults over the built-in ones
+	expect(map[string]interface{}{
+		"journal_mode": "wal",
+		"busy_timeout": "5000",
+		"foreign_keys": "1",
+		"synchronous":  "0",
+		"cache_size":   "-4000",
+	})
+
+	// Pools fetched before the change keep working until they are released
+	readers, err := manager.GetConnection("test")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	writer, err := manager.getWriter("test")
+	if err != nil {
+		t.Fatalf("getWriter failed: %v", err)
+	}
+
+	off, mmap := false, int64(1<<20)
+	options, err := manager.SetConnectionOptions(ctx, "test", ConnectionOptions{TempStore: "memory", MmapSize: &mmap, ForeignKeys: &off}, false)
+	if err != nil {
+		t.Fatalf("SetConnectionOptions failed: %v", err)
+	}
+	if options.TempStore != "MEMORY" || options.Synchronous != "OFF" || *options.CacheSize != -4000 {
+		t.Errorf("Unexpected options in effect: %+v", options)
+	}
+	var n int
+	if err := readers.QueryRow("SELECT COUNT(*) FROM test").Scan(&n); err != nil {
+		t.Errorf("Read through the replaced readers failed: %v", err)
+	}
+	if _, err := writer.Exec("INSERT INTO test DEFAULT VALUES"); err != nil {
+		t.Errorf("Write through the replaced writer failed: %v", err)
+	}
+	expect(map[string]interface{}{
+		"temp_store":   "2",
+		"mmap_size":    "1048576",
+		"foreign_keys": "0",
+		"synchronous":  "0",
+	})
+
+	info, err := registry.GetDatabase("test")
+	if err != nil {
+		t.Fatalf("GetDatabase failed: %v", err)
+	}
+	if info.Options.TempStore != "MEMORY" || info.Options.Synchronous != "OFF" || info.Options.CacheSize != nil {
+		t.Errorf("Unexpected stored options: %+v", info.Options)
+	}
+	databases, err := manager.ListDatabases()
+	if err != nil || len(databases) != 1 || databases[0].Options.JournalMode != "WAL" || databases[0].Options.TempStore != "MEMORY" {
+		t.Errorf("Expected the options in effect to be listed, got %+v (err: %v)", databases, err)
+	}
+
+	// Resetting returns to the defaults
+	if _, err := manager.SetConnectionOptions(ctx, "test", ConnectionOptions{}, true); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	expect(map[string]interface{}{"temp_store": "0", "foreign_keys": "1"})
+	if info, _ := registry.GetDatabase("test"); info.Options != (ConnectionOptions{}) {
+		t.Errorf("Expected reset to clear the stored options, got %+v", info.Options)
+	}
+
+	if _, err := manager.SetConnectionOptions(ctx, "test", ConnectionOptions{JournalMode: "bogus"}, false); err == nil {
+		t.Error("Expected an invalid journal mode to be refused")
+	}
+	tx, err := manager.BeginTransaction(ctx, "test")
+	if err != nil {
+		t.Fatalf("BeginTransaction failed: %v", err)
+	}
+	if _, err := manager.SetConnectionOptions(ctx, "test", ConnectionOptions{}, true); !errors.Is(err, ErrTransactionActive) {
+		t.Errorf("Expected ErrTransactionActive, got %v", err)
+	}
+	tx, _ = manager.UseTransaction(ctx, tx.ID())
+	tx.Rollback()
+	tx.Done()
+
+	// A transaction begun alongside a change either refuses the change or
+	// runs with the new options
+	for i := 0; i < 20; i++ {
+		enforce := i%2 == 0
+		begun := make(chan *Transaction)
+		go func() {
+			tx, err := manager.BeginTransaction(ctx, "test")
+			if err != nil {
+				t.Errorf("BeginTransaction failed: %v", err)
+			}
+			begun <- tx
+		}()
+		_, setErr := manager.SetConnectionOptions(ctx, "test", ConnectionOptions{ForeignKeys: &enforce}, false)
+		tx := <-begun
+		if tx == nil {
+			continue
+		}
+		tx, _ = manager.UseTransaction(ctx, tx.ID())
+		var foreignKeys bool
+		rows, err := tx.QueryContext(ctx, "PRAGMA foreign_keys")
+		if err != nil {
+			t.Fatalf("PRAGMA foreign_keys failed: %v", err)
+		}
+		for rows.Next() {
+			rows.Scan(&foreignKeys)
+		}
+		rows.Close()
+		switch {
+		case setErr == nil && foreignKeys != enforce:
+			t.Errorf("Transaction begun during a change runs with foreign_keys=%v, want %v", foreignKeys, enforce)
+		case setErr != nil && !errors.Is(setErr, ErrTransactionActive):
+			t.Errorf("Expected ErrTransactionActive, got %v", setErr)
+		}
+		tx.Rollback()
+		tx.Done()
+	}
+}
@@ -0,0 +1,373 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrNotReadOnly is returned when a query that must be read-only would modify the database
+var ErrNotReadOnly = errors.New("query is not read-only")
+
+// StatementError reports which statement of a query was refused
+type StatementError struct {
+	Index     int // 1-based position of the statement within the query
+	Statement string
+	Reason    string
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d (%s): %s", e.Index, abbreviate(e.Statement, 60), e.Reason)
+}
+
+// Unwrap lets callers match refused statements with errors.Is(err, ErrNotReadOnly)
+func (e *StatementError) Unwrap() error {
+	return ErrNotReadOnly
+}
+
+// stateChangingKeywords start statements that SQLite reports as read-only but
+// which change the state of a pooled connection or write outside the database
+var stateChangingKeywords = map[string]bool{
+	"ATTACH":    true,
+	"BEGIN":     true,
+	"COMMIT":    true,
+	"DETACH":    true,
+	"END":       true,
+	"RELEASE":   true,
+	"ROLLBACK":  true,
+	"SAVEPOINT": true,
+	"VACUUM":    true,
+}
+
+// readPragmas are the pragmas allowed without an argument. Many pragmas that
+// change the connection, such as query_only or foreign_keys, only report their
+// value when called without one.
+var readPragmas = map[string]bool{
+	"application_id":    true,
+	"auto_vacuum":       true,
+	"busy_timeout":      true,
+	"cache_size":        true,
+	"collation_list":    true,
+	"compile_options":   true,
+	"data_version":      true,
+	"database_list":     true,
+	"encoding":          true,
+	"foreign_key_check": true,
+	"foreign_keys":      true,
+	"freelist_count":    true,
+	"function_list":     true,
+	"integrity_check":   true,
+	"journal_mode":      true,
+	"mmap_size":         true,
+	"module_list":       true,
+	"page_count":        true,
+	"page_size":         true,
+	"pragma_list":       true,
+	"query_only":        true,
+	"quick_check":       true,
+	"schema_version":    true,
+	"synchronous":       true,
+	"table_list":        true,
+	"temp_store":        true,
+	"user_version":      true,
+}
+
+// argumentPragmas are the pragmas allowed with an argument in parentheses,
+// which names the table, index or schema they describe
+var argumentPragmas = map[string]bool{
+	"foreign_key_check": true,
+	"foreign_key_list":  true,
+	"index_info":        true,
+	"index_list":        true,
+	"index_xinfo":       true,
+	"integrity_check":   true,
+	"quick_check":       true,
+	"table_info":        true,
+	"table_list":        true,
+	"table_xinfo":       true,
+}
+
+// readOnlyPragma reports whether a PRAGMA statement only reads: one of
+// readPragmas without an argument, or one of argumentPragmas with one in
+// parentheses. Assignments are never allowed.
+func readOnlyPragma(stmt string) bool {
+	// Collect the pragma's name up to its argument, skipping comments
+	var name strings.Builder
+	argument := ""
+	for i := 0; i < len(stmt); i++ {
+		switch {
+		case strings.HasPrefix(stmt[i:], "--"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				i = len(stmt)
+			} else {
+				i += end
+			}
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				i = len(stmt)
+			} else {
+				i += end + 3
+			}
+		case stmt[i] == '(' || stmt[i] == '=':
+			argument = stmt[i : i+1]
+			i = len(stmt)
+		case stmt[i] == ';':
+			i = len(stmt)
+		default:
+			name.WriteByte(stmt[i])
+		}
+	}
+
+	// Drop the keyword and a schema prefix, and unquote the name
+	fields := strings.Fields(name.String())
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "PRAGMA") {
+		return false
+	}
+	parts := strings.Split(strings.Join(fields[1:], ""), ".")
+	pragma := strings.ToLower(strings.Trim(parts[len(parts)-1], "\"`[]"))
+
+	switch argument {
+	case "":
+		return readPragmas[pragma]
+	case "(":
+		return argumentPragmas[pragma]
+	}
+	return false
+}
+
+// VerifyReadOnly checks that query consists of exactly one statement that SQLite
+// itself considers read-only, and returns that statement. Each statement is
+// prepared against the database so the check sees the real schema, including
+// writes hidden behind CTEs or EXPLAIN.
+func (m *Manager) VerifyReadOnly(ctx context.Context, name string, query string) (string, error) {
+	db, err := m.GetConnection(name)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	return verifyReadOnly(ctx, conn, query)
+}
+
+// verifyReadOnly implements VerifyReadOnly on a connection
+func verifyReadOnly(ctx context.Context, conn *sql.Conn, query string) (string, error) {
+	statements := SplitStatements(query)
+	if len(statements) == 0 {
+		return "", errors.New("query is empty")
+	}
+	if err := checkStatements(conn, statements); err != nil {
+		return "", err
+	}
+
+	if len(statements) > 1 {
+		return "", &StatementError{Index: 2, Statement: statements[1], Reason: "multiple statements are not allowed"}
+	}
+
+	return statements[0], nil
+}
+
+// checkStatements checks that every statement is one SQLite considers
+// read-only and that leaves the connection's state alone
+func checkStatements(conn *sql.Conn, statements []string) error {
+	for i, stmt := range statements {
+		keyword := strings.ToUpper(leadingKeyword(stmt))
+		if stateChangingKeywords[keyword] {
+			return &StatementError{Index: i + 1, Statement: stmt, Reason: keyword + " statements are not allowed"}
+		}
+		if keyword == "PRAGMA" && !readOnlyPragma(stmt) {
+			return &StatementError{Index: i + 1, Statement: stmt, Reason: "only pragmas that read are allowed"}
+		}
+
+		var readOnly bool
+		err := conn.Raw(func(driverConn interface{}) error {
+			sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected driver connection %T", driverConn)
+			}
+			prepared, err := sqliteConn.Prepare(stmt)
+			if err != nil {
+				return err
+			}
+			defer prepared.Close()
+			readOnly = prepared.(*sqlite3.SQLiteStmt).Readonly()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		if !readOnly {
+			return &StatementError{Index: i + 1, Statement: stmt, Reason: "statement modifies the database"}
+		}
+	}
+	return nil
+}
+
+// readsOnly reports whether every statement of query only reads, as judged
+// by VerifyReadOnly, on a connection taken from reader. Queries that cannot
+// be prepared count as writes, leaving the writer to report their error.
+func readsOnly(ctx context.Context, reader *sql.DB, query string) bool {
+	statements := SplitStatements(query)
+	if len(statements) == 0 {
+		return false
+	}
+	conn, err := reader.Conn(ctx)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	return checkStatements(conn, statements) == nil
+}
+
+// SelectsOnly reports whether every statement of query is a SELECT or a
+// VALUES list, judging by its first keyword without preparing it. It errs
+// towards false: a WITH clause, for one, may lead to a write.
+func SelectsOnly(query string) bool {
+	statements := SplitStatements(query)
+	for _, stmt := range statements {
+		switch strings.ToUpper(leadingKeyword(stmt)) {
+		case "SELECT", "VALUES":
+		default:
+			return false
+		}
+	}
+	return len(statements) > 0
+}
+
+// pageableKeywords start statements that can be wrapped in a subquery
+var pageableKeywords = map[string]bool{
+	"SELECT": true,
+	"VALUES": true,
+	"WITH":   true,
+}
+
+// PageQuery wraps a SELECT, WITH or VALUES statement so that only limit rows
+// starting at offset are returned. It reports false for other statements,
+// such as EXPLAIN or PRAGMA, whose rows have to be skipped while reading.
+func PageQuery(statement string, limit, offset int) (string, bool) {
+	if !pageableKeywords[strings.ToUpper(leadingKeyword(statement))] {
+		return statement, false
+	}
+	// Newlines keep a trailing line comment from swallowing the closing parenthesis
+	return fmt.Sprintf("SELECT * FROM (\n%s\n) LIMIT %d OFFSET %d", statement, limit, offset), true
+}
+
+// SplitStatements splits SQL text on semicolons that are outside string
+// literals, quoted identifiers and comments. Statements containing only
+// whitespace and comments are dropped.
+func SplitStatements(query string) []string {
+	var statements []string
+	start := 0
+
+	add := func(end int) {
+		stmt := strings.TrimSpace(query[start:end])
+		if leadingKeyword(stmt) != "" {
+			statements = append(statements, stmt)
+		}
+	}
+
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"', '`':
+			i = skipQuoted(query, i, c)
+		case '[':
+			if end := strings.IndexByte(query[i:], ']'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+		case '-':
+			if strings.HasPrefix(query[i:], "--") {
+				if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+					i += end
+				} else {
+					i = len(query)
+				}
+			}
+		case '/':
+			if strings.HasPrefix(query[i:], "/*") {
+				if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+					i += end + 3
+				} else {
+					i = len(query)
+				}
+			}
+		case ';':
+			add(i)
+			start = i + 1
+		}
+	}
+	if start < len(query) {
+		add(len(query))
+	}
+
+	return statements
+}
+
+// skipQuoted returns the index of the quote closing the literal opened at i.
+// Doubled quotes inside the literal are escapes.
+func skipQuoted(query string, i int, quote byte) int {
+	for j := i + 1; j < len(query); j++ {
+		if query[j] != quote {
+			continue
+		}
+		if j+1 < len(query) && query[j+1] == quote {
+			j++
+			continue
+		}
+		return j
+	}
+	return len(query)
+}
+
+// leadingKeyword returns the first word of a statement, skipping whitespace and comments
+func leadingKeyword(stmt string) string {
+	for {
+		stmt = strings.TrimLeft(stmt, " \t\r\n\f")
+		switch {
+		case strings.HasPrefix(stmt, "--"):
+			end := strings.IndexByte(stmt, '\n')
+			if end < 0 {
+				return ""
+			}
+			stmt = stmt[end+1:]
+		case strings.HasPrefix(stmt, "/*"):
+			end := strings.Index(stmt, "*/")
+			if end < 0 {
+				return ""
+			}
+			stmt = stmt[end+2:]
+		default:
+			end := strings.IndexFunc(stmt, func(r rune) bool {
+				return !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+			})
+			if end < 0 {
+				return stmt
+			}
+			if end == 0 && stmt != "" {
+				// Statements starting with punctuation, such as a parenthesized VALUES list
+				return stmt[:1]
+			}
+			return stmt[:end]
+		}
+	}
+}
+
+// abbreviate shortens s to at most n bytes for error messages
+func abbreviate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
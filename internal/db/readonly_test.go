@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1;", []string{"SELECT 1"}},
+		{"SELECT 1; -- trailing comment", []string{"SELECT 1"}},
+		{"SELECT 1; DROP TABLE x", []string{"SELECT 1", "DROP TABLE x"}},
+		{"SELECT 'a;b', \"c;d\", [e;f], `g;h`", []string{"SELECT 'a;b', \"c;d\", [e;f], `g;h`"}},
+		{"SELECT 'it''s;fine'", []string{"SELECT 'it''s;fine'"}},
+		{"SELECT 1 /* ; */ -- ;\n; SELECT 2", []string{"SELECT 1 /* ; */ -- ;", "SELECT 2"}},
+		{"  ;; /* only a comment */ ", nil},
+	}
+
+	for _, tt := range tests {
+		if got := SplitStatements(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitStatements(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSelectsOnly(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT 1":                     true,
+		"/* c */ select 1; VALUES (1)": true,
+		"SELECT 1; DELETE FROM t":      false,
+		"WITH x AS (SELECT 1) INSERT INTO t SELECT * FROM x": false,
+		"PRAGMA table_info(t)":                               false,
+		"":                                                   false,
+	}
+	for query, want := range tests {
+		if got := SelectsOnly(query); got != want {
+			t.Errorf("SelectsOnly(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestVerifyReadOnly(t *testing.T) {
+	db, dbPath := testutil.CreateTempDB(t)
+	testutil.ExecuteSQL(t, db, `CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT)`)
+
+	registry, err := NewRegistry(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	err = registry.RegisterDatabase(&DatabaseInfo{
+		ID:     "test-db",
+		Name:   "test",
+		Path:   dbPath,
+		Owner:  "test",
+		Status: "active",
+	})
+	if err != nil {
+		t.Fatalf("Failed to register database: %v", err)
+	}
+
+	manager := NewManager(registry)
+	defer manager.CloseAll()
+
+	allowed := []string{
+		"SELECT * FROM test",
+		"select * from test;",
+		"WITH recent AS (SELECT * FROM test) SELECT name FROM recent",
+		"VALUES (1, 'a'), (2, 'b')",
+		"EXPLAIN QUERY PLAN SELECT * FROM test WHERE id = 1",
+		"PRAGMA table_info(test)",
+		"PRAGMA main.table_info('test')",
+		"PRAGMA query_only",
+		"pragma \"user_version\";",
+		"/* leading comment */ SELECT 1",
+	}
+	for _, query := range allowed {
+		if _, err := manager.VerifyReadOnly(context.Background(), "test", query); err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", query, err)
+		}
+	}
+
+	refused := []struct {
+		query string
+		index int
+	}{
+		{"DELETE FROM test", 1},
+		{"EXPLAIN DELETE FROM test", 1},
+		{"WITH x AS (SELECT 1) INSERT INTO test (name) SELECT 'a' FROM x", 1},
+		{"SELECT 1; DROP TABLE test", 2},
+		{"SELECT 1; SELECT 2", 2},
+		{"BEGIN", 1},
+		{"ATTACH DATABASE ':memory:' AS other", 1},
+		{"PRAGMA user_version = 5", 1},
+		{"PRAGMA query_only(0)", 1},
+		{"PRAGMA main.query_only = false", 1},
+		{"PRAGMA writable_schema(1)", 1},
+		{"PRAGMA foreign_keys(0)", 1},
+		{"PRAGMA cache_size(1)", 1},
+		{"PRAGMA case_sensitive_like(1)", 1},
+		{"PRAGMA /* table_info */ query_only(0)", 1},
+		{"/* PRAGMA table_info */ PRAGMA query_only (0)", 1},
+		{"PRAGMA shrink_memory", 1},
+		{"SELECT 1; PRAGMA query_only(0)", 2},
+	}
+	for _, tt := range refused {
+		_, err := manager.VerifyReadOnly(context.Background(), "test", tt.query)
+		var stmtErr *StatementError
+		if !errors.As(err, &stmtErr) || !errors.Is(err, ErrNotReadOnly) {
+			t.Errorf("Expected %q to be refused, got %v", tt.query, err)
+			continue
+		}
+		if stmtErr.Index != tt.index {
+			t.Errorf("Expected %q to be refused at statement %d, got %d", tt.query, tt.index, stmtErr.Index)
+		}
+	}
+
+	// Invalid SQL is reported as an error rather than accepted
+	if _, err := manager.VerifyReadOnly(context.Background(), "test", "SELECT * FROM missing"); err == nil {
+		t.Error("Expected error for missing table, got nil")
+	}
+	if _, err := manager.VerifyReadOnly(context.Background(), "test", " ; "); err == nil {
+		t.Error("Expected error for empty query, got nil")
+	}
+
+	// The table survives the refused DROP
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'test'").Scan(&count); err != nil || count != 1 {
+		t.Errorf("Expected test table to still exist (count %d, err %v)", count, err)
+	}
+}
+
+func TestPageQuery(t *testing.T) {
+	query, ok := PageQuery("SELECT x FROM t -- trailing comment", 11, 20)
+	if !ok || query != "SELECT * FROM (\nSELECT x FROM t -- trailing comment\n) LIMIT 11 OFFSET 20" {
+		t.Errorf("Unexpected paged query %q", query)
+	}
+
+	for _, stmt := range []string{"WITH c AS (SELECT 1) SELECT * FROM c", "VALUES (1), (2)", "/* c */ select 1"} {
+		if _, ok := PageQuery(stmt, 10, 0); !ok {
+			t.Errorf("Expected %q to be pageable", stmt)
+		}
+	}
+	for _, stmt := range []string{"EXPLAIN QUERY PLAN SELECT 1", "PRAGMA table_info(t)"} {
+		if query, ok := PageQuery(stmt, 10, 0); ok || query != stmt {
+			t.Errorf("Expected %q to be left alone, got %q", stmt, query)
+		}
+	}
+}
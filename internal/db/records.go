@@ -0,0 +1,375 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnfiltered is returned for an update or delete without a filter that
+// does not explicitly allow touching every row
+var ErrUnfiltered = errors.New("refusing to modify every row without allow_all")
+
+// Condition compares a column with a value in a record filter
+type Condition struct {
+	Column string      `json:"column" description:"Column to compare"`
+	Op     string      `json:"op,omitempty" enum:"=,!=,<,<=,>,>=,like,in,not in" description:"Comparison operator, = by default; = and != with a null value test for NULL"`
+	Value  interface{} `json:"value,omitempty" description:"Value to compare with; an array for in and not in"`
+}
+
+// Filter selects records by primary key, by conditions, or both. All of
+// its parts must hold.
+type Filter struct {
+	Key   map[string]interface{}
+	Where []Condition
+}
+
+// Empty reports whether the filter selects every row
+func (f Filter) Empty() bool {
+	return len(f.Key) == 0 && len(f.Where) == 0
+}
+
+// comparisonOps are the operators a Condition may use
+var comparisonOps = map[string]bool{
+	"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"like": true, "in": true, "not in": true,
+}
+
+// Conflict actions
+const (
+	// ConflictDoNothing skips rows that violate a uniqueness constraint
+	ConflictDoNothing = "do_nothing"
+	// ConflictUpdate updates the existing row a new row conflicts with
+	ConflictUpdate = "update"
+)
+
+// Conflict describes what an insert does with rows that violate a primary
+// key or unique constraint
+type Conflict struct {
+	Action string   `json:"action" enum:"do_nothing,update" description:"Skip conflicting rows (do_nothing) or update the existing rows (update)"`
+	Target []string `json:"target,omitempty" description:"Columns of the primary key or unique constraint to handle; required for update, any constraint when empty with do_nothing"`
+	Update []string `json:"update,omitempty" description:"Columns set to the inserted values on update; all inserted columns outside the target by default"`
+}
+
+// clause builds the ON CONFLICT clause for an insert of the given declared columns
+func (c *Conflict) clause(t *Table, inserted []string) (string, error) {
+	target, err := t.QuoteColumns(c.Target)
+	if err != nil {
+		return "", err
+	}
+	clause := " ON CONFLICT"
+	if len(target) > 0 {
+		clause += " (" + strings.Join(target, ", ") + ")"
+	}
+
+	switch c.Action {
+	case ConflictDoNothing:
+		if len(c.Update) > 0 {
+			return "", errors.New("update columns need the update conflict action")
+		}
+		return clause + " DO NOTHING", nil
+	case ConflictUpdate:
+	default:
+		return "", fmt.Errorf("unknown conflict action %q", c.Action)
+	}
+	if len(target) == 0 {
+		return "", errors.New("the update conflict action needs target columns")
+	}
+
+	update := c.Update
+	if len(update) == 0 {
+		isTarget := make(map[string]bool, len(target))
+		for _, col := range target {
+			isTarget[col] = true
+		}
+		for _, col := range inserted {
+			if !isTarget[QuoteIdentifier(col)] {
+				update = append(update, col)
+			}
+		}
+		if len(update) == 0 {
+			return clause + " DO NOTHING", nil
+		}
+	}
+	quoted, err := t.QuoteColumns(update)
+	if err != nil {
+		return "", err
+	}
+	sets := make([]string, len(quoted))
+	for i, col := range quoted {
+		sets[i] = col + " = excluded." + col
+	}
+	return clause + " DO UPDATE SET " + strings.Join(sets, ", "), nil
+}
+
+// InsertRows builds an INSERT of rowCount rows of values for columns,
+// handling conflicts as described by conflict when it is not nil
+func (t *Table) InsertRows(columns []string, rowCount int, conflict *Conflict) (string, error) {
+	if len(columns) == 0 {
+		return "", errors.New("no columns to insert")
+	}
+	if rowCount == 0 {
+		return "", errors.New("no rows to insert")
+	}
+	quoted, err := t.QuoteColumns(columns)
+	if err != nil {
+		return "", err
+	}
+
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	rows := make([]string, rowCount)
+	for i := range rows {
+		rows[i] = row
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", t.Quoted(), strings.Join(quoted, ", "), strings.Join(rows, ", "))
+
+	if conflict != nil {
+		inserted := make([]string, len(columns))
+		for i, col := range columns {
+			// Known to exist once quoted
+			inserted[i], _ = t.ColumnName(col)
+		}
+		clause, err := conflict.clause(t, inserted)
+		if err != nil {
+			return "", err
+		}
+		query += clause
+	}
+	return query, nil
+}
+
+// Insert builds an INSERT of a single record given as column names mapped
+// to values
+func (t *Table) Insert(data map[string]interface{}, conflict *Conflict, returning bool) (string, []interface{}, error) {
+	columns, values := sortedData(data)
+	query, err := t.InsertRows(columns, 1, conflict)
+	if err != nil {
+		return "", nil, err
+	}
+	return withReturning(query, returning), values, nil
+}
+
+// Update builds an UPDATE setting data on the records selected by filter
+func (t *Table) Update(data map[string]interface{}, filter Filter, allowAll, returning bool) (string, []interface{}, error) {
+	if len(data) == 0 {
+		return "", nil, errors.New("no columns to update")
+	}
+	columns, values := sortedData(data)
+	quoted, err := t.QuoteColumns(columns)
+	if err != nil {
+		return "", nil, err
+	}
+	sets := make([]string, len(quoted))
+	for i, col := range quoted {
+		sets[i] = col + " = ?"
+	}
+
+	where, args, err := t.where(filter, allowAll)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s%s", t.Quoted(), strings.Join(sets, ", "), where)
+	return withReturning(query, returning), append(values, args...), nil
+}
+
+// Delete builds a DELETE of the records selected by filter
+func (t *Table) Delete(filter Filter, allowAll, returning bool) (string, []interface{}, error) {
+	where, args, err := t.where(filter, allowAll)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s%s", t.Quoted(), where)
+	return withReturning(query, returning), args, nil
+}
+
+// Upsert builds an INSERT of data that updates the existing record instead
+// when the target columns, the primary key by default, match one. The
+// target columns must be set in data and carry a primary key or unique
+// constraint.
+func (t *Table) Upsert(data map[string]interface{}, target []string, returning bool) (string, []interface{}, error) {
+	if len(target) == 0 {
+		target = t.key
+		if len(target) == 0 {
+			return "", nil, fmt.Errorf("table %s has no primary key; set conflict_columns", t.name)
+		}
+	}
+
+	set := make(map[string]bool, len(data))
+	for col := range data {
+		if declared, err := t.ColumnName(col); err == nil {
+			set[declared] = true
+		}
+	}
+	for _, col := range target {
+		declared, err := t.ColumnName(col)
+		if err != nil {
+			return "", nil, err
+		}
+		if !set[declared] {
+			return "", nil, fmt.Errorf("conflict column %q is not set in data", col)
+		}
+	}
+
+	return t.Insert(data, &Conflict{Action: ConflictUpdate, Target: target}, returning)
+}
+
+// sortedData returns the columns of data sorted by name with their values
+// in the same order
+func sortedData(data map[string]interface{}) ([]string, []interface{}) {
+	columns := make([]string, 0, len(data))
+	for col := range data {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		values[i] = data[col]
+	}
+	return columns, values
+}
+
+// where builds the WHERE clause of filter, which is empty only when
+// allowAll permits an unfiltered statement
+func (t *Table) where(filter Filter, allowAll bool) (string, []interface{}, error) {
+	if filter.Empty() {
+		if !allowAll {
+			return "", nil, ErrUnfiltered
+		}
+		return "", nil, nil
+	}
+
+	var terms []string
+	var args []interface{}
+
+	if len(filter.Key) > 0 {
+		key := t.PrimaryKey()
+		keyError := fmt.Errorf("key must name exactly the primary key columns %s", strings.Join(key, ", "))
+		if len(filter.Key) != len(key) {
+			return "", nil, keyError
+		}
+		values := make(map[string]interface{}, len(filter.Key))
+		for col, value := range filter.Key {
+			values[strings.ToLower(col)] = value
+		}
+		for _, col := range key {
+			value, ok := values[strings.ToLower(col)]
+			if !ok {
+				return "", nil, keyError
+			}
+			terms = append(terms, QuoteIdentifier(col)+" = ?")
+			args = append(args, value)
+		}
+	}
+
+	for _, cond := range filter.Where {
+		term, condArgs, err := t.condition(cond)
+		if err != nil {
+			return "", nil, err
+		}
+		terms = append(terms, term)
+		args = append(args, condArgs...)
+	}
+
+	return " WHERE " + strings.Join(terms, " AND "), args, nil
+}
+
+// condition builds the SQL of a single condition
+func (t *Table) condition(cond Condition) (string, []interface{}, error) {
+	col, err := t.Column(cond.Column)
+	if err != nil {
+		return "", nil, err
+	}
+	op := strings.ToLower(cond.Op)
+	if op == "" {
+		op = "="
+	}
+	if !comparisonOps[op] {
+		return "", nil, fmt.Errorf("unknown operator %q", cond.Op)
+	}
+
+	switch op {
+	case "=", "!=":
+		if cond.Value == nil {
+			if op == "=" {
+				return col + " IS NULL", nil, nil
+			}
+			return col + " IS NOT NULL", nil, nil
+		}
+	case "in", "not in":
+		list, ok := cond.Value.([]interface{})
+		if !ok || len(list) == 0 {
+			return "", nil, fmt.Errorf("operator %s on %q needs a non-empty array value", op, cond.Column)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(list)), ", ")
+		return fmt.Sprintf("%s %s (%s)", col, strings.ToUpper(op), placeholders), list, nil
+	}
+	if cond.Value == nil {
+		return "", nil, fmt.Errorf("operator %s on %q needs a value", op, cond.Column)
+	}
+	return fmt.Sprintf("%s %s ?", col, strings.ToUpper(op)), []interface{}{cond.Value}, nil
+}
+
+func withReturning(query string, returning bool) string {
+	if returning {
+		return query + " RETURNING *"
+	}
+	return query
+}
+
+// ExecuteReturning runs a modifying statement with a RETURNING clause on the
+// named database. It reports how many rows the statement returned and keeps
+// those that fit in limits.
+func (m *Manager) ExecuteReturning(ctx context.Context, name string, limits Limits, query string, args ...interface{}) ([]map[string]interface{}, int64, Truncation, error) {
+	if err := m.CheckWritable(name); err != nil {
+		return nil, 0, Truncation{}, err
+	}
+	if err := m.checkNoTransaction(name); err != nil {
+		return nil, 0, Truncation{}, err
+	}
+
+	conn, err := m.getWriter(name)
+	if err != nil {
+		return nil, 0, Truncation{}, err
+	}
+	return QueryReturning(ctx, conn, limits, query, args...)
+}
+
+// QueryReturning runs a modifying statement with a RETURNING clause through
+// q, as Manager.ExecuteReturning does
+func QueryReturning(ctx context.Context, q Queryer, limits Limits, query string, args ...interface{}) ([]map[string]interface{}, int64, Truncation, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, Truncation{}, translateError(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, 0, Truncation{}, err
+	}
+
+	// Every row is read so that the statement runs to completion
+	guard := NewRowGuard(limits, FormatJSON, columns)
+	result := []map[string]interface{}{}
+	var affected int64
+	err = EachRowValues(rows, func(values []interface{}) error {
+		affected++
+		if !guard.Truncated && guard.Admit(values) {
+			result = append(result, RowMap(columns, values))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, Truncation{}, translateError(err)
+	}
+	if guard.Truncated {
+		total := int(affected)
+		guard.TotalRows = &total
+	}
+	return result, affected, guard.Truncation, nil
+}
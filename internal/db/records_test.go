@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTableStatements(t *testing.T) {
+	table := NewTable(`order "items"`, []TableColumn{
+		{Name: "item", Type: "TEXT", PrimaryKey: 2},
+		{Name: "order_id", Type: "INTEGER", PrimaryKey: 1},
+		{Name: "qty", Type: "INTEGER"},
+	})
+
+	if got := table.PrimaryKey(); !reflect.DeepEqual(got, []string{"order_id", "item"}) {
+		t.Errorf("PrimaryKey() = %v", got)
+	}
+
+	tests := []struct {
+		name      string
+		build     func() (string, []interface{}, error)
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			"update by key",
+			func() (string, []interface{}, error) {
+				return table.Update(map[string]interface{}{"qty": 2}, Filter{Key: map[string]interface{}{"item": "a", "order_id": 1}}, false, true)
+			},
+			`UPDATE "order ""items""" SET "qty" = ? WHERE "order_id" = ? AND "item" = ? RETURNING *`,
+			[]interface{}{2, 1, "a"},
+		},
+		{
+			"delete by conditions",
+			func() (string, []interface{}, error) {
+				return table.Delete(Filter{Where: []Condition{
+					{Column: "qty", Op: "<", Value: 1},
+					{Column: "item", Value: nil},
+					{Column: "order_id", Op: "not in", Value: []interface{}{1, 2}},
+				}}, false, false)
+			},
+			`DELETE FROM "order ""items""" WHERE "qty" < ? AND "item" IS NULL AND "order_id" NOT IN (?, ?)`,
+			[]interface{}{1, 1, 2},
+		},
+		{
+			"delete everything",
+			func() (string, []interface{}, error) { return table.Delete(Filter{}, true, false) },
+			`DELETE FROM "order ""items"""`,
+			nil,
+		},
+		{
+			"upsert on primary key",
+			func() (string, []interface{}, error) {
+				return table.Upsert(map[string]interface{}{"order_id": 1, "item": "a", "qty": 3}, nil, false)
+			},
+			`INSERT INTO "order ""items""" ("item", "order_id", "qty") VALUES (?, ?, ?) ON CONFLICT ("order_id", "item") DO UPDATE SET "qty" = excluded."qty"`,
+			[]interface{}{"a", 1, 3},
+		},
+		{
+			"upsert of key columns only",
+			func() (string, []interface{}, error) {
+				return table.Upsert(map[string]interface{}{"order_id": 1, "item": "a"}, nil, false)
+			},
+			`INSERT INTO "order ""items""" ("item", "order_id") VALUES (?, ?) ON CONFLICT ("order_id", "item") DO NOTHING`,
+			[]interface{}{"a", 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := tt.build()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if query != tt.wantQuery {
+				t.Errorf("query = %s, want %s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+
+	invalid := map[string]func() (string, []interface{}, error){
+		"unknown data column": func() (string, []interface{}, error) {
+			return table.Update(map[string]interface{}{"price": 1}, Filter{Key: map[string]interface{}{"order_id": 1, "item": "a"}}, false, false)
+		},
+		"unknown condition column": func() (string, []interface{}, error) {
+			return table.Delete(Filter{Where: []Condition{{Column: "qty; DROP TABLE x", Value: 1}}}, false, false)
+		},
+		"partial key": func() (string, []interface{}, error) {
+			return table.Delete(Filter{Key: map[string]interface{}{"order_id": 1}}, false, false)
+		},
+		"unknown operator": func() (string, []interface{}, error) {
+			return table.Delete(Filter{Where: []Condition{{Column: "qty", Op: "OR 1=1 --", Value: 1}}}, false, false)
+		},
+		"empty in list": func() (string, []interface{}, error) {
+			return table.Delete(Filter{Where: []Condition{{Column: "qty", Op: "in", Value: []interface{}{}}}}, false, false)
+		},
+		"conflict column missing from data": func() (string, []interface{}, error) {
+			return table.Upsert(map[string]interface{}{"order_id": 1, "qty": 3}, nil, false)
+		},
+	}
+	for name, build := range invalid {
+		if _, _, err := build(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, _, err := table.Update(map[string]interface{}{"qty": 0}, Filter{}, false, false); !errors.Is(err, ErrUnfiltered) {
+		t.Errorf("Expected ErrUnfiltered for an unfiltered update, got %v", err)
+	}
+	if _, _, err := table.Delete(Filter{}, false, false); !errors.Is(err, ErrUnfiltered) {
+		t.Errorf("Expected ErrUnfiltered for an unfiltered delete, got %v", err)
+	}
+}
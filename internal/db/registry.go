@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -22,6 +23,9 @@ type DatabaseInfo struct {
 	LastAccessed *time.Time `json:"last_accessed,omitempty"`
 	Owner        string     `json:"owner"`
 	Status       string     `json:"status"`
+
+	// Options are the connection options set for this database
+	Options ConnectionOptions `json:"options"`
 }
 
 const createRegistryTableSQL = `
@@ -44,6 +48,16 @@ CREATE TABLE IF NOT EXISTS database_metadata (
     PRIMARY KEY (database_id, key)
 );`
 
+// optionsKey is the database_metadata key holding a database's connection options as JSON
+const optionsKey = "connection_options"
+
+// selectDatabasesSQL reads registry entries together with their connection options
+const selectDatabasesSQL = `
+SELECT d.id, d.name, d.path, d.description, d.readonly, d.created_at, d.last_accessed, d.owner, d.status, m.value
+FROM registered_databases d
+LEFT JOIN database_metadata m ON m.database_id = d.id AND m.key = '` + optionsKey + `'
+`
+
 func NewRegistry(path string) (*Registry, error) {
 	db, err := sql.Open("sqlite3", path)
 	if err != nil {
@@ -90,17 +104,49 @@ func (r *Registry) RegisterDatabase(info *DatabaseInfo) error {
 	if err != nil {
 		return err
 	}
+	if err := setOptions(tx, info.ID, info.Options); err != nil {
+		return err
+	}
 
 	return tx.Commit()
 }
 
-func (r *Registry) GetDatabase(name string) (*DatabaseInfo, error) {
+// SetConnectionOptions replaces the connection options stored for a database
+func (r *Registry) SetConnectionOptions(id string, options ConnectionOptions) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setOptions(tx, id, options); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setOptions stores the connection options of a database, removing them when none are set
+func setOptions(tx *sql.Tx, id string, options ConnectionOptions) error {
+	if options == (ConnectionOptions{}) {
+		_, err := tx.Exec(`DELETE FROM database_metadata WHERE database_id = ? AND key = ?`, id, optionsKey)
+		return err
+	}
+	value, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO database_metadata (database_id, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (database_id, key) DO UPDATE SET value = excluded.value
+	`, id, optionsKey, string(value))
+	return err
+}
+
+// scanDatabase reads a row of selectDatabasesSQL
+func scanDatabase(row interface{ Scan(...interface{}) error }) (*DatabaseInfo, error) {
 	var info DatabaseInfo
-	err := r.db.QueryRow(`
-		SELECT id, name, path, description, readonly, created_at, last_accessed, owner, status
-		FROM registered_databases
-		WHERE name = ?
-	`, name).Scan(
+	var options sql.NullString
+	err := row.Scan(
 		&info.ID,
 		&info.Name,
 		&info.Path,
@@ -110,14 +156,28 @@ func (r *Registry) GetDatabase(name string) (*DatabaseInfo, error) {
 		&info.LastAccessed,
 		&info.Owner,
 		&info.Status,
+		&options,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if options.Valid {
+		if err := json.Unmarshal([]byte(options.String), &info.Options); err != nil {
+			return nil, err
+		}
+	}
+	return &info, nil
+}
+
+func (r *Registry) GetDatabase(name string) (*DatabaseInfo, error) {
+	info, err := scanDatabase(r.db.QueryRow(selectDatabasesSQL+`WHERE d.name = ?`, name))
 	if err == sql.ErrNoRows {
 		return nil, errors.New("database not found")
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &info, nil
+	return info, nil
 }
 
 func (r *Registry) UpdateLastAccessed(id string) error {
@@ -130,11 +190,7 @@ func (r *Registry) UpdateLastAccessed(id string) error {
 }
 
 func (r *Registry) ListDatabases() ([]DatabaseInfo, error) {
-	rows, err := r.db.Query(`
-		SELECT id, name, path, description, readonly, created_at, last_accessed, owner, status
-		FROM registered_databases
-		ORDER BY name
-	`)
+	rows, err := r.db.Query(selectDatabasesSQL + `ORDER BY d.name`)
 	if err != nil {
 		return nil, err
 	}
@@ -142,22 +198,11 @@ func (r *Registry) ListDatabases() ([]DatabaseInfo, error) {
 
 	var databases []DatabaseInfo
 	for rows.Next() {
-		var info DatabaseInfo
-		err := rows.Scan(
-			&info.ID,
-			&info.Name,
-			&info.Path,
-			&info.Description,
-			&info.ReadOnly,
-			&info.CreatedAt,
-			&info.LastAccessed,
-			&info.Owner,
-			&info.Status,
-		)
+		info, err := scanDatabase(rows)
 		if err != nil {
 			return nil, err
 		}
-		databases = append(databases, info)
+		databases = append(databases, *info)
 	}
 	return databases, rows.Err()
 }
@@ -0,0 +1,92 @@
+package db
+
+import "database/sql"
+
+// Column describes a result column with the type it was declared with, which
+// is empty for expressions
+type Column struct {
+	Name     string `json:"name"`
+	DeclType string `json:"decltype"`
+}
+
+// ScanRows reads all remaining rows into maps keyed by column name
+func ScanRows(rows *sql.Rows) ([]string, []map[string]interface{}, error) {
+	var resultSet []map[string]interface{}
+	columns, err := EachRow(rows, func(row map[string]interface{}) error {
+		resultSet = append(resultSet, row)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return columns, resultSet, nil
+}
+
+// EachRow calls fn with every remaining row as a map keyed by column name,
+// without holding more than one row in memory. It stops at the first error
+// returned by fn.
+func EachRow(rows *sql.Rows, fn func(row map[string]interface{}) error) ([]string, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	err = EachRowValues(rows, func(values []interface{}) error {
+		return fn(RowMap(columns, values))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return columns, nil
+}
+
+// EachRowValues calls fn with the values of every remaining row in column
+// order. Every row gets a new slice. It stops at the first error returned by fn.
+func EachRowValues(rows *sql.Rows, fn func(values []interface{}) error) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	valuePtrs := make([]interface{}, len(columns))
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		for i := range columns {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return err
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// RowMap keys the values of a row by column name. Later columns win when
+// names repeat.
+func RowMap(columns []string, values []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		row[col] = values[i]
+	}
+	return row
+}
+
+// ResultColumns returns the name and declared type of every column of rows
+func ResultColumns(rows *sql.Rows) ([]Column, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]Column, len(types))
+	for i, typ := range types {
+		columns[i] = Column{Name: typ.Name(), DeclType: typ.DatabaseTypeName()}
+	}
+	return columns, nil
+}
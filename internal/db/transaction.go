@@ -0,0 +1,309 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrTransactionNotFound is returned for a transaction handle that is unknown,
+// already finished or rolled back after being idle too long
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ErrTransactionActive is returned when a database has an open transaction
+// that the operation would have to wait for
+var ErrTransactionActive = errors.New("database has an open transaction")
+
+// ErrSavepointNotFound is returned for a savepoint the transaction does not hold
+var ErrSavepointNotFound = errors.New("savepoint not found")
+
+// DefaultTransactionIdleTimeout is how long a transaction may go unused before
+// it is rolled back
+const DefaultTransactionIdleTimeout = time.Minute
+
+// Executor runs statements on a database, a connection or a transaction
+type Executor interface {
+	Queryer
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Transaction is a transaction that spans several requests. It runs on a
+// connection of its own, so the database's readers and writer stay available
+// to everyone else while it is open. One request at a time may use it.
+type Transaction struct {
+	id       string
+	database string
+
+	manager *Manager
+	db      *sql.DB
+	conn    *sql.Conn
+
+	// sem is held by the request using the transaction
+	sem        chan struct{}
+	timer      *time.Timer
+	idle       time.Duration
+	closed     bool
+	savepoints []string
+}
+
+// ID returns the handle of the transaction
+func (t *Transaction) ID() string {
+	return t.id
+}
+
+// Database returns the name of the database the transaction runs on
+func (t *Transaction) Database() string {
+	return t.database
+}
+
+// IdleTimeout returns how long the transaction may go unused
+func (t *Transaction) IdleTimeout() time.Duration {
+	return t.idle
+}
+
+// Savepoints returns the names of the savepoints held, outermost first
+func (t *Transaction) Savepoints() []string {
+	return append([]string{}, t.savepoints...)
+}
+
+// SetTransactionIdleTimeout changes how long a transaction may go unused
+// before it is rolled back. It applies to transactions begun afterwards.
+func (m *Manager) SetTransactionIdleTimeout(timeout time.Duration) {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	m.txIdleTimeout = timeout
+}
+
+// BeginTransaction opens a transaction on the named database. A database
+// has at most one open transaction.
+func (m *Manager) BeginTransaction(ctx context.Context, name string) (*Transaction, error) {
+	// Holding txMu while reading the options keeps SetConnectionOptions from
+	// changing them underneath the new transaction
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	if _, exists := m.databaseTransactions[name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionActive, name)
+	}
+
+	shared, err := m.getConnection(name)
+	if err != nil {
+		return nil, err
+	}
+
+	db := openDatabase(shared.info, shared.options, false)
+	db.SetMaxOpenConns(1)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+
+	tx := &Transaction{
+		id:       uuid.New().String(),
+		database: name,
+		manager:  m,
+		db:       db,
+		conn:     conn,
+		sem:      make(chan struct{}, 1),
+		idle:     m.txIdleTimeout,
+	}
+	if tx.idle > 0 {
+		tx.timer = time.AfterFunc(tx.idle, func() { m.expireTransaction(tx) })
+	}
+	m.transactions[tx.id] = tx
+	m.databaseTransactions[name] = tx
+	return tx, nil
+}
+
+// UseTransaction returns an open transaction for a request to use, waiting
+// while another request uses it. The caller must call Done when finished.
+func (m *Manager) UseTransaction(ctx context.Context, id string) (*Transaction, error) {
+	m.txMu.Lock()
+	tx, exists := m.transactions[id]
+	m.txMu.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, id)
+	}
+
+	select {
+	case tx.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if tx.closed {
+		<-tx.sem
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, id)
+	}
+	if tx.timer != nil {
+		tx.timer.Stop()
+	}
+	return tx, nil
+}
+
+// Done hands the transaction back after a request used it, restarting its
+// idle timeout
+func (t *Transaction) Done() {
+	if !t.closed && t.timer != nil {
+		t.timer.Reset(t.idle)
+	}
+	<-t.sem
+}
+
+// Commit commits the transaction and closes its connection. The caller
+// still hands the transaction back with Done.
+func (t *Transaction) Commit() error {
+	return t.manager.closeTransaction(t, "COMMIT")
+}
+
+// Rollback rolls back the transaction and closes its connection. The caller
+// still hands the transaction back with Done.
+func (t *Transaction) Rollback() error {
+	return t.manager.closeTransaction(t, "ROLLBACK")
+}
+
+// expireTransaction rolls back a transaction whose idle timeout elapsed,
+// unless a request picked it up in the meantime
+func (m *Manager) expireTransaction(tx *Transaction) {
+	select {
+	case tx.sem <- struct{}{}:
+	default:
+		return
+	}
+	defer func() { <-tx.sem }()
+	if !tx.closed {
+		m.closeTransaction(tx, "ROLLBACK")
+	}
+}
+
+// closeTransaction ends a transaction held by the caller with COMMIT or
+// ROLLBACK. The transaction is forgotten even when the statement fails,
+// and closing its connection rolls back whatever was not committed.
+func (m *Manager) closeTransaction(tx *Transaction, statement string) error {
+	m.txMu.Lock()
+	delete(m.transactions, tx.id)
+	delete(m.databaseTransactions, tx.database)
+	m.txMu.Unlock()
+
+	tx.closed = true
+	if tx.timer != nil {
+		tx.timer.Stop()
+	}
+
+	_, err := tx.conn.ExecContext(context.Background(), statement)
+	tx.conn.Close()
+	tx.db.Close()
+	return translateError(err)
+}
+
+// rollbackTransactions rolls back every open transaction
+func (m *Manager) rollbackTransactions() {
+	m.txMu.Lock()
+	open := make([]*Transaction, 0, len(m.transactions))
+	for _, tx := range m.transactions {
+		open = append(open, tx)
+	}
+	m.txMu.Unlock()
+
+	for _, tx := range open {
+		tx.sem <- struct{}{}
+		if !tx.closed {
+			m.closeTransaction(tx, "ROLLBACK")
+		}
+		<-tx.sem
+	}
+}
+
+// checkNoTransaction refuses work on the writer of a database
+// that would block on its open transaction
+func (m *Manager) checkNoTransaction(name string) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	return m.transactionActive(name)
+}
+
+// transactionActive implements checkNoTransaction for callers holding txMu
+func (m *Manager) transactionActive(name string) error {
+	if _, exists := m.databaseTransactions[name]; exists {
+		return fmt.Errorf("%w: %s; pass its transaction_id or wait for it to finish", ErrTransactionActive, name)
+	}
+	return nil
+}
+
+// QueryContext runs a query inside the transaction
+func (t *Transaction) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := t.conn.QueryContext(ctx, query, args...)
+	return rows, translateError(err)
+}
+
+// ExecContext runs a statement inside the transaction
+func (t *Transaction) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := t.conn.ExecContext(ctx, query, args...)
+	return result, translateError(err)
+}
+
+// VerifyReadOnly checks a query as Manager.VerifyReadOnly does, against the
+// schema as the transaction sees it
+func (t *Transaction) VerifyReadOnly(ctx context.Context, query string) (string, error) {
+	return verifyReadOnly(ctx, t.conn, query)
+}
+
+// Savepoint starts a savepoint that can be rolled back to without ending
+// the transaction
+func (t *Transaction) Savepoint(ctx context.Context, name string) error {
+	if name == "" {
+		return errors.New("savepoint name is empty")
+	}
+	if _, err := t.conn.ExecContext(ctx, "SAVEPOINT "+QuoteIdentifier(name)); err != nil {
+		return translateError(err)
+	}
+	t.savepoints = append(t.savepoints, name)
+	return nil
+}
+
+// ReleaseSavepoint keeps the changes made since a savepoint and forgets it
+// together with the savepoints started after it
+func (t *Transaction) ReleaseSavepoint(ctx context.Context, name string) error {
+	i, err := t.savepoint(name)
+	if err != nil {
+		return err
+	}
+	if _, err := t.conn.ExecContext(ctx, "RELEASE SAVEPOINT "+QuoteIdentifier(name)); err != nil {
+		return translateError(err)
+	}
+	t.savepoints = t.savepoints[:i]
+	return nil
+}
+
+// RollbackToSavepoint undoes the changes made since a savepoint and forgets
+// the savepoints started after it. The savepoint itself stays.
+func (t *Transaction) RollbackToSavepoint(ctx context.Context, name string) error {
+	i, err := t.savepoint(name)
+	if err != nil {
+		return err
+	}
+	if _, err := t.conn.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+QuoteIdentifier(name)); err != nil {
+		return translateError(err)
+	}
+	t.savepoints = t.savepoints[:i+1]
+	return nil
+}
+
+// savepoint returns the position of the innermost savepoint with the given name
+func (t *Transaction) savepoint(name string) (int, error) {
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if t.savepoints[i] == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrSavepointNotFound, name)
+}
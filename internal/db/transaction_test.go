@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/testutil"
+)
+
+func TestTransactions(t *testing.T) {
+	conn, dbPath := testutil.CreateTempDB(t)
+	testutil.ExecuteSQL(t, conn, `CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT)`)
+	conn.Close()
+
+	registry, err := NewRegistry(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+	if err := registry.RegisterDatabase(&DatabaseInfo{ID: "test-db", Name: "test", Path: dbPath, Status: "active"}); err != nil {
+		t.Fatalf("Failed to register database: %v", err)
+	}
+
+	manager := NewManager(registry)
+	defer manager.CloseAll()
+	ctx := context.Background()
+
+	count := func() int {
+		t.Helper()
+		pool, err := manager.GetConnection("test")
+		if err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+		var n int
+		if err := pool.QueryRowContext(ctx, "SELECT COUNT(*) FROM test").Scan(&n); err != nil {
+			t.Fatalf("Count failed: %v", err)
+		}
+		return n
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		tx, err := manager.BeginTransaction(ctx, "test")
+		if err != nil {
+			t.Fatalf("BeginTransaction failed: %v", err)
+		}
+		if _, err := manager.BeginTransaction(ctx, "test"); !errors.Is(err, ErrTransactionActive) {
+			t.Errorf("Expected ErrTransactionActive for a second transaction, got %v", err)
+		}
+
+		tx, err = manager.UseTransaction(ctx, tx.ID())
+		if err != nil {
+			t.Fatalf("UseTransaction failed: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO test (name) VALUES ('a')"); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		tx.Done()
+
+		// Others read the committed state from the reader pool and
+		// fail fast instead of waiting to write
+		if n := count(); n != 0 {
+			t.Errorf("Uncommitted row visible outside the transaction: %d rows", n)
+		}
+		if _, err := manager.ExecuteUpdate(ctx, "test", "INSERT INTO test (name) VALUES ('b')"); !errors.Is(err, ErrTransactionActive) {
+			t.Errorf("Expected ErrTransactionActive for a write outside the transaction, got %v", err)
+		}
+
+		tx, err = manager.UseTransaction(ctx, tx.ID())
+		if err != nil {
+			t.Fatalf("UseTransaction failed: %v", err)
+		}
+		err = tx.Commit()
+		tx.Done()
+		if err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		if n := count(); n != 1 {
+			t.Errorf("Expected 1 committed row, got %d", n)
+		}
+		if _, err := manager.UseTransaction(ctx, tx.ID()); !errors.Is(err, ErrTransactionNotFound) {
+			t.Errorf("Expected ErrTransactionNotFound after commit, got %v", err)
+		}
+	})
+
+	t.Run("Savepoints", func(t *testing.T) {
+		tx, err := manager.BeginTransaction(ctx, "test")
+		if err != nil {
+			t.Fatalf("BeginTransaction failed: %v", err)
+		}
+		tx, _ = manager.UseTransaction(ctx, tx.ID())
+		defer tx.Done()
+
+		steps := []struct {
+			run  func() error
+			want []string
+		}{
+			{func() error { return tx.Savepoint(ctx, "one") }, []string{"one"}},
+			{func() error { _, err := tx.ExecContext(ctx, "INSERT INTO test (name) VALUES ('c')"); return err }, []string{"one"}},
+			{func() error { return tx.Savepoint(ctx, `two"`) }, []string{"one", `two"`}},
+			{func() error { _, err := tx.ExecContext(ctx, "INSERT INTO test (name) VALUES ('d')"); return err }, []string{"one", `two"`}},
+			{func() error { return tx.RollbackToSavepoint(ctx, "one") }, []string{"one"}},
+			{func() error { return tx.ReleaseSavepoint(ctx, "one") }, []string{}},
+		}
+		for i, step := range steps {
+			if err := step.run(); err != nil {
+				t.Fatalf("Step %d failed: %v", i+1, err)
+			}
+			if got := tx.Savepoints(); !reflect.DeepEqual(got, step.want) {
+				t.Errorf("Step %d: savepoints = %v, want %v", i+1, got, step.want)
+			}
+		}
+		if err := tx.ReleaseSavepoint(ctx, "one"); !errors.Is(err, ErrSavepointNotFound) {
+			t.Errorf("Expected ErrSavepointNotFound, got %v", err)
+		}
+
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+		if n := count(); n != 1 {
+			t.Errorf("Expected the rollback to leave 1 row, got %d", n)
+		}
+	})
+
+	t.Run("IdleTimeout", func(t *testing.T) {
+		manager.SetTransactionIdleTimeout(50 * time.Millisecond)
+		defer manager.SetTransactionIdleTimeout(DefaultTransactionIdleTimeout)
+
+		tx, err := manager.BeginTransaction(ctx, "test")
+		if err != nil {
+			t.Fatalf("BeginTransaction failed: %v", err)
+		}
+		tx, _ = manager.UseTransaction(ctx, tx.ID())
+		if _, err := tx.ExecContext(ctx, "INSERT INTO test (name) VALUES ('e')"); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		// A transaction in use does not expire
+		time.Sleep(100 * time.Millisecond)
+		tx.Done()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			_, err := manager.UseTransaction(ctx, tx.ID())
+			if errors.Is(err, ErrTransactionNotFound) {
+				break
+			}
+			if err == nil {
+				tx.Done()
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Idle transaction was not rolled back")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if n := count(); n != 1 {
+			t.Errorf("Expected the expired transaction to be rolled back, got %d rows", n)
+		}
+		if _, err := manager.ExecuteUpdate(ctx, "test", "INSERT INTO test (name) VALUES ('f')"); err != nil {
+			t.Errorf("Write after expiry failed: %v", err)
+		}
+	})
+
+	t.Run("CloseAll", func(t *testing.T) {
+		tx, err := manager.BeginTransaction(ctx, "test")
+		if err != nil {
+			t.Fatalf("BeginTransaction failed: %v", err)
+		}
+		if err := manager.CloseAll(); err != nil {
+			t.Fatalf("CloseAll failed: %v", err)
+		}
+		if _, err := manager.UseTransaction(ctx, tx.ID()); !errors.Is(err, ErrTransactionNotFound) {
+			t.Errorf("Expected CloseAll to roll back open transactions, got %v", err)
+		}
+	})
+}
@@ -1,95 +1,167 @@
 package mcp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/cursor"
 )
 
 // Capability represents a server capability
 type Capability struct {
-	Name        string      `json:"name"`
-	Type        string      `json:"type"` // tool, resource, or prompt
-	Description string      `json:"description"`
-	Schema      interface{} `json:"schema,omitempty"`
+	Name        string           `json:"name"`
+	Type        string           `json:"type"` // tool, resource, or prompt
+	Description string           `json:"description"`
+	Schema      interface{}      `json:"schema,omitempty"`
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
 }
 
 // CapabilityRegistry manages server capabilities
 type CapabilityRegistry struct {
-	tools     map[string]ToolHandler
-	resources map[string]ResourceHandler
-	prompts   map[string]string
+	tools     map[string]*registeredTool
+	resources map[string]*registeredResource
+	templates []*registeredTemplate
+	prompts   map[string]*registeredPrompt
+	pageSize  int
 }
 
-// ToolHandler handles tool invocations
-type ToolHandler func(params json.RawMessage) (interface{}, error)
+// DefaultListPageSize is the number of entries per page of the MCP list methods
+const DefaultListPageSize = 100
+
+// ToolHandler handles tool invocations. The context is canceled when the
+// client cancels the request or the server shuts down.
+type ToolHandler func(ctx context.Context, params json.RawMessage) (interface{}, error)
 
-// ResourceHandler provides resource content
-type ResourceHandler func() (interface{}, error)
+// ResourceHandler provides resource content. Params holds the variables
+// extracted from the URI of a resource template and is empty for concrete resources.
+type ResourceHandler func(ctx context.Context, params map[string]string) (interface{}, error)
 
 // NewCapabilityRegistry creates a new capability registry
 func NewCapabilityRegistry() *CapabilityRegistry {
 	return &CapabilityRegistry{
-		tools:     make(map[string]ToolHandler),
-		resources: make(map[string]ResourceHandler),
-		prompts:   make(map[string]string),
+		tools:     make(map[string]*registeredTool),
+		resources: make(map[string]*registeredResource),
+		prompts:   make(map[string]*registeredPrompt),
+		pageSize:  DefaultListPageSize,
+	}
+}
+
+// SetPageSize changes the number of entries per page of the MCP list methods
+func (r *CapabilityRegistry) SetPageSize(n int) {
+	r.pageSize = n
+}
+
+// listPage returns the bounds of the page of a list of n entries requested
+// by msg's cursor param, the cursor of the next page, or an error response
+func (r *CapabilityRegistry) listPage(msg *JSONRPCMessage, n int) (start, end int, next string, errResp *JSONRPCMessage) {
+	var params struct {
+		Cursor string `json:"cursor"`
+	}
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return 0, 0, "", newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid params")
+		}
+	}
+
+	start, end, next, err := cursor.Page(n, params.Cursor, r.pageSize)
+	if err != nil {
+		return 0, 0, "", newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid cursor")
 	}
+	return start, end, next, nil
 }
 
-// RegisterTool registers a new tool capability
-func (r *CapabilityRegistry) RegisterTool(name string, handler ToolHandler, schema interface{}) error {
+// RegisterTool registers a new tool capability described by meta. The input is either the tool's
+// request struct, from which the input schema is derived, or a *JSONSchema.
+// The output is likewise the tool's response struct or a *JSONSchema; tools
+// with an output schema return their result as structured content too. A nil
+// output declares no output schema.
+func (r *CapabilityRegistry) RegisterTool(name string, meta ToolMetadata, handler ToolHandler, input, output interface{}) error {
 	if _, exists := r.tools[name]; exists {
 		return fmt.Errorf("tool %s already registered", name)
 	}
-	r.tools[name] = handler
+	tool := Tool{
+		Name:        name,
+		Title:       meta.Title,
+		Description: meta.Description,
+		InputSchema: SchemaFor(input),
+	}
+	if meta.Annotations != nil {
+		// Older clients read the title from the annotations
+		annotations := *meta.Annotations
+		if annotations.Title == "" {
+			annotations.Title = meta.Title
+		}
+		tool.Annotations = &annotations
+	}
+	if output != nil {
+		tool.OutputSchema = SchemaFor(output)
+	}
+	r.tools[name] = &registeredTool{tool: tool, handler: handler}
 	return nil
 }
 
-// RegisterResource registers a new resource capability
-func (r *CapabilityRegistry) RegisterResource(name string, handler ResourceHandler) error {
-	if _, exists := r.resources[name]; exists {
-		return fmt.Errorf("resource %s already registered", name)
+// RegisterResource registers a new resource capability. The resource is
+// addressable by URI through resources/read and by name through invoke.
+func (r *CapabilityRegistry) RegisterResource(resource Resource, handler ResourceHandler) error {
+	if _, exists := r.resources[resource.Name]; exists {
+		return fmt.Errorf("resource %s already registered", resource.Name)
+	}
+	for _, res := range r.resources {
+		if res.resource.URI == resource.URI {
+			return fmt.Errorf("resource %s already registered", resource.URI)
+		}
+	}
+	r.resources[resource.Name] = &registeredResource{
+		resource: resource,
+		handler:  handler,
 	}
-	r.resources[name] = handler
 	return nil
 }
 
-// RegisterPrompt registers a new prompt capability
-func (r *CapabilityRegistry) RegisterPrompt(name string, content string) error {
+// RegisterPrompt registers a new static prompt capability
+func (r *CapabilityRegistry) RegisterPrompt(name, description, content string) error {
 	if _, exists := r.prompts[name]; exists {
 		return fmt.Errorf("prompt %s already registered", name)
 	}
-	r.prompts[name] = content
+	r.prompts[name] = &registeredPrompt{
+		prompt:  Prompt{Name: name, Description: description},
+		content: content,
+	}
 	return nil
 }
 
-// GetCapabilities returns all registered capabilities
+// GetCapabilities returns all registered capabilities with their
+// descriptions, sorted by type and name
 func (r *CapabilityRegistry) GetCapabilities() []Capability {
 	var caps []Capability
 
 	// Add tools
-	for name := range r.tools {
+	for _, tool := range r.listTools() {
 		caps = append(caps, Capability{
-			Name:        name,
+			Name:        tool.Name,
 			Type:        "tool",
-			Description: fmt.Sprintf("Tool: %s", name),
+			Description: tool.Description,
+			Schema:      tool.InputSchema,
+			Annotations: tool.Annotations,
 		})
 	}
 
 	// Add resources
-	for name := range r.resources {
+	for _, resource := range r.listResources() {
 		caps = append(caps, Capability{
-			Name:        name,
+			Name:        resource.Name,
 			Type:        "resource",
-			Description: fmt.Sprintf("Resource: %s", name),
+			Description: resource.Description,
 		})
 	}
 
 	// Add prompts
-	for name := range r.prompts {
+	for _, prompt := range r.listPrompts() {
 		caps = append(caps, Capability{
-			Name:        name,
+			Name:        prompt.Name,
 			Type:        "prompt",
-			Description: fmt.Sprintf("Prompt: %s", name),
+			Description: prompt.Description,
 		})
 	}
 
@@ -97,7 +169,7 @@ func (r *CapabilityRegistry) GetCapabilities() []Capability {
 }
 
 // HandleCapabilityRequest processes a capability request
-func (r *CapabilityRegistry) HandleCapabilityRequest(msg *JSONRPCMessage) *JSONRPCMessage {
+func (r *CapabilityRegistry) HandleCapabilityRequest(ctx context.Context, msg *JSONRPCMessage) *JSONRPCMessage {
 	switch msg.Method {
 	case "capabilities":
 		return &JSONRPCMessage{
@@ -105,6 +177,20 @@ func (r *CapabilityRegistry) HandleCapabilityRequest(msg *JSONRPCMessage) *JSONR
 			ID:      msg.ID,
 			Result:  r.GetCapabilities(),
 		}
+	case "tools/list":
+		return r.handleListTools(msg)
+	case "tools/call":
+		return r.handleCallTool(ctx, msg)
+	case "resources/list":
+		return r.handleListResources(msg)
+	case "resources/templates/list":
+		return r.handleListResourceTemplates(msg)
+	case "resources/read":
+		return r.handleReadResource(ctx, msg)
+	case "prompts/list":
+		return r.handleListPrompts(msg)
+	case "prompts/get":
+		return r.handleGetPrompt(ctx, msg)
 	case "invoke":
 		var params struct {
 			Name   string          `json:"name"`
@@ -115,21 +201,21 @@ func (r *CapabilityRegistry) HandleCapabilityRequest(msg *JSONRPCMessage) *JSONR
 				Version: "2.0",
 				ID:      msg.ID,
 				Error: &JSONRPCError{
-					Code:    -32602,
+					Code:    ErrCodeInvalidParams,
 					Message: "Invalid params",
 				},
 			}
 		}
 
 		// Handle based on capability type
-		if handler, ok := r.tools[params.Name]; ok {
-			result, err := handler(params.Params)
+		if tool, ok := r.tools[params.Name]; ok {
+			result, err := tool.handler(ctx, params.Params)
 			if err != nil {
 				return &JSONRPCMessage{
 					Version: "2.0",
 					ID:      msg.ID,
 					Error: &JSONRPCError{
-						Code:    -32000,
+						Code:    ErrCodeServerError,
 						Message: err.Error(),
 					},
 				}
@@ -141,14 +227,14 @@ func (r *CapabilityRegistry) HandleCapabilityRequest(msg *JSONRPCMessage) *JSONR
 			}
 		}
 
-		if handler, ok := r.resources[params.Name]; ok {
-			result, err := handler()
+		if res, ok := r.resources[params.Name]; ok {
+			result, err := res.handler(ctx, map[string]string{})
 			if err != nil {
 				return &JSONRPCMessage{
 					Version: "2.0",
 					ID:      msg.ID,
 					Error: &JSONRPCError{
-						Code:    -32000,
+						Code:    ErrCodeServerError,
 						Message: err.Error(),
 					},
 				}
@@ -160,19 +246,33 @@ func (r *CapabilityRegistry) HandleCapabilityRequest(msg *JSONRPCMessage) *JSONR
 			}
 		}
 
-		if content, ok := r.prompts[params.Name]; ok {
-			return &JSONRPCMessage{
-				Version: "2.0",
-				ID:      msg.ID,
-				Result:  content,
+		if p, ok := r.prompts[params.Name]; ok {
+			if p.handler == nil {
+				return &JSONRPCMessage{
+					Version: "2.0",
+					ID:      msg.ID,
+					Result:  p.content,
+				}
+			}
+
+			args := map[string]string{}
+			if len(params.Params) > 0 {
+				if err := json.Unmarshal(params.Params, &args); err != nil {
+					return newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid params")
+				}
+			}
+			result, err := p.handler(ctx, args)
+			if err != nil {
+				return newErrorResponse(msg.ID, ErrCodeServerError, err.Error())
 			}
+			return newResultResponse(msg.ID, result)
 		}
 
 		return &JSONRPCMessage{
 			Version: "2.0",
 			ID:      msg.ID,
 			Error: &JSONRPCError{
-				Code:    -32601,
+				Code:    ErrCodeMethodNotFound,
 				Message: "Capability not found",
 			},
 		}
@@ -181,7 +281,7 @@ func (r *CapabilityRegistry) HandleCapabilityRequest(msg *JSONRPCMessage) *JSONR
 			Version: "2.0",
 			ID:      msg.ID,
 			Error: &JSONRPCError{
-				Code:    -32601,
+				Code:    ErrCodeMethodNotFound,
 				Message: "Method not found",
 			},
 		}
@@ -0,0 +1,392 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/db"
+)
+
+// DefaultMaxWorkers is the number of requests the server executes at once unless configured otherwise
+const DefaultMaxWorkers = 8
+
+// maxPendingRequests bounds how many requests a single session may have
+// queued or running before its transport stops reading further messages
+const maxPendingRequests = 64
+
+// errDuplicateRequest is returned when a request reuses the ID of one still in flight
+var errDuplicateRequest = errors.New("duplicate request ID")
+
+// inFlightRequest describes a request that has been accepted but not yet answered
+type inFlightRequest struct {
+	method    string
+	started   time.Time
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// requestKey normalizes a JSON-RPC ID so that a notifications/cancelled
+// requestId matches the ID of the request it refers to
+func requestKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// beginRequest records msg as in flight on the session and returns the
+// context it runs under, which is canceled by a matching notifications/cancelled
+func (s *Session) beginRequest(parent context.Context, msg *JSONRPCMessage) (context.Context, error) {
+	key := requestKey(*msg.ID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.requests[key]; exists {
+		return nil, errDuplicateRequest
+	}
+	if s.requests == nil {
+		s.requests = make(map[string]*inFlightRequest)
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	s.requests[key] = &inFlightRequest{method: msg.Method, started: time.Now(), cancel: cancel}
+	return ctx, nil
+}
+
+// endRequest releases a request started with beginRequest and reports whether
+// the client cancelled it, in which case no response may be sent
+func (s *Session) endRequest(msg *JSONRPCMessage) bool {
+	key := requestKey(*msg.ID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[key]
+	if !ok {
+		return false
+	}
+	req.cancel()
+	delete(s.requests, key)
+	return req.cancelled
+}
+
+// cancelRequest cancels the in-flight request with the given ID. Unknown IDs
+// are ignored: the request may already have completed.
+func (s *Session) cancelRequest(id json.RawMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[requestKey(id)]
+	if !ok {
+		return false
+	}
+	req.cancelled = true
+	req.cancel()
+	return true
+}
+
+// InFlight returns the number of requests on the session that have not been answered yet
+func (s *Session) InFlight() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.requests)
+}
+
+// handleRequest runs msg on sess with cancellation tracking, returning the
+// response to send or nil when there is none
+func handleRequest(ctx context.Context, sess *Session, handler SessionHandler, msg *JSONRPCMessage) *JSONRPCMessage {
+	if msg.ID == nil || msg.Method == "initialize" {
+		return handler(ctx, sess, msg)
+	}
+
+	reqCtx, err := sess.beginRequest(ctx, msg)
+	if err != nil {
+		return newErrorResponse(msg.ID, ErrCodeInvalidRequest, "Duplicate request ID")
+	}
+	response := handler(reqCtx, sess, msg)
+	if sess.endRequest(msg) {
+		return nil
+	}
+	return response
+}
+
+// dispatcher runs the requests received on one session concurrently and
+// hands each response to reply as soon as it is ready. A request that may
+// write to a database starts after every earlier request addressing it, and
+// a read starts after the earlier writes, so a query sent after an insert
+// always observes it while consecutive reads run side by side. Calls inside
+// a transaction are ordered as writes on it and on its database. Notifications
+// and initialize are handled inline, before any later message is read.
+type dispatcher struct {
+	ctx     context.Context
+	sess    *Session
+	handler SessionHandler
+	reply   func(*JSONRPCMessage) error
+	pending chan struct{}
+	wg      sync.WaitGroup
+
+	mu    sync.Mutex
+	lanes map[string]*lane
+	err   error
+
+	// transactions maps the lane of a transaction to that of its database,
+	// as named by the calls inside the transaction that carry both
+	transactions map[string]string
+}
+
+// lane tracks the requests of a session addressing one database. A request
+// addressing several databases waits in the lane of each.
+type lane struct {
+	// write is closed when the latest write has been answered
+	write chan struct{}
+	// reads are closed when the reads received since that write are answered
+	reads []chan struct{}
+	// pending counts the requests not yet answered
+	pending int
+}
+
+// newDispatcher creates a dispatcher whose requests run under ctx. Requests
+// already dispatched keep running when ctx is canceled so they can be drained.
+// Notifications related to a request are written with reply as well.
+func newDispatcher(ctx context.Context, sess *Session, handler SessionHandler, reply func(*JSONRPCMessage) error) *dispatcher {
+	return &dispatcher{
+		ctx:     withRequestNotifier(context.WithoutCancel(ctx), reply),
+		sess:    sess,
+		handler: handler,
+		reply:   reply,
+		pending: make(chan struct{}, maxPendingRequests),
+		lanes:   make(map[string]*lane),
+
+		transactions: make(map[string]string),
+	}
+}
+
+// dispatch schedules msg for execution, blocking while the session already
+// has maxPendingRequests outstanding
+func (d *dispatcher) dispatch(msg *JSONRPCMessage) {
+	if msg.ID == nil || msg.Method == "initialize" {
+		d.send(d.handler(d.ctx, d.sess, msg))
+		return
+	}
+
+	// Register the request before it is queued so it can be cancelled while waiting
+	ctx, err := d.sess.beginRequest(d.ctx, msg)
+	if err != nil {
+		d.send(newErrorResponse(msg.ID, ErrCodeInvalidRequest, "Duplicate request ID"))
+		return
+	}
+
+	d.pending <- struct{}{}
+
+	// Order the request after those it must observe or must not overtake
+	keys, write := orderingKeys(msg)
+	var prev []chan struct{}
+	var done chan struct{}
+	if len(keys) > 0 {
+		done = make(chan struct{})
+		d.mu.Lock()
+		keys = d.withTransactionDatabase(keys)
+		for _, key := range keys {
+			l := d.lanes[key]
+			if l == nil {
+				l = &lane{}
+				d.lanes[key] = l
+			}
+			if l.write != nil {
+				prev = append(prev, l.write)
+			}
+			if write {
+				prev = append(prev, l.reads...)
+				l.write, l.reads = done, nil
+			} else {
+				l.reads = append(l.reads, done)
+			}
+			l.pending++
+		}
+		d.mu.Unlock()
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer func() { <-d.pending }()
+
+		for _, p := range prev {
+			<-p
+		}
+		response := d.handler(ctx, d.sess, msg)
+		if d.sess.endRequest(msg) {
+			response = nil
+		}
+
+		if done != nil {
+			d.mu.Lock()
+			for _, key := range keys {
+				l := d.lanes[key]
+				if l.pending--; l.pending == 0 {
+					delete(d.lanes, key)
+				}
+			}
+			d.mu.Unlock()
+		}
+
+		d.send(response)
+		if done != nil {
+			close(done)
+		}
+	}()
+}
+
+// withTransactionDatabase adds the lane of a transaction's database to keys
+// naming only the transaction, as those of db/commit do, so that the requests
+// on the database sent afterwards observe the commit. d.mu must be held.
+func (d *dispatcher) withTransactionDatabase(keys []string) []string {
+	var transaction, database string
+	for _, key := range keys {
+		if strings.HasPrefix(key, transactionLane) {
+			transaction = key
+		} else {
+			database = key
+		}
+	}
+	switch {
+	case transaction == "":
+	case database != "":
+		d.transactions[transaction] = database
+	case d.transactions[transaction] != "":
+		keys = append(keys, d.transactions[transaction])
+	}
+	return keys
+}
+
+// send writes a response, remembering the first write failure
+func (d *dispatcher) send(response *JSONRPCMessage) {
+	if response == nil {
+		return
+	}
+	if err := d.reply(response); err != nil {
+		d.mu.Lock()
+		if d.err == nil {
+			d.err = err
+		}
+		d.mu.Unlock()
+	}
+}
+
+// wait blocks until every dispatched request has been answered and returns
+// the first error encountered writing a response
+func (d *dispatcher) wait() error {
+	d.wg.Wait()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// readTools are the tools that never write to the database they address
+var readTools = map[string]bool{
+	"db/list_databases":   true,
+	"db/query":            true,
+	"db/get_tables":       true,
+	"db/get_schema":       true,
+	"db/get_table_schema": true,
+}
+
+// transactionLane prefixes the ordering key of a transaction
+const transactionLane = "transaction/"
+
+// toolArguments are the arguments naming what a tool call operates on
+type toolArguments struct {
+	Name          string `json:"name"`
+	DatabaseName  string `json:"database_name"`
+	TransactionID string `json:"transaction_id"`
+	Operations    []struct {
+		Database string `json:"database"`
+		Query    string `json:"query"`
+	} `json:"operations"`
+}
+
+// orderingKeys returns the databases a request operates on, none when the
+// request may run concurrently with every other request, and whether the
+// request may write to them
+func orderingKeys(msg *JSONRPCMessage) ([]string, bool) {
+	switch msg.Method {
+	case "tools/call":
+		var params struct {
+			Name      string        `json:"name"`
+			Arguments toolArguments `json:"arguments"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, false
+		}
+		return toolKeys(params.Name, params.Arguments)
+	case "invoke":
+		var params struct {
+			Name   string        `json:"name"`
+			Params toolArguments `json:"params"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, false
+		}
+		return toolKeys(params.Name, params.Params)
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, false
+		}
+		u, err := url.Parse(params.URI)
+		if err != nil || u.Scheme != "sqlite" || u.Host == "databases" {
+			return nil, false
+		}
+		return []string{u.Host}, false
+	}
+	return nil, false
+}
+
+// toolKeys implements orderingKeys for a call of the named tool. A call
+// inside a transaction also addresses the transaction and counts as a write,
+// since it waits for the transaction's previous call. A batch addresses the
+// database of each of its operations, and only reads when all of them are
+// plain SELECT statements.
+func toolKeys(name string, args toolArguments) ([]string, bool) {
+	switch {
+	case name == "db/register_database":
+		return distinctKeys(args.Name), true
+	case args.TransactionID != "":
+		return distinctKeys(args.DatabaseName, transactionLane+args.TransactionID), true
+	case name != "db/batch":
+		return distinctKeys(args.DatabaseName), !readTools[name]
+	}
+
+	keys := []string{args.DatabaseName}
+	write := len(args.Operations) == 0
+	for _, operation := range args.Operations {
+		keys = append(keys, operation.Database)
+		if !db.SelectsOnly(operation.Query) {
+			write = true
+		}
+	}
+	return distinctKeys(keys...), write
+}
+
+// distinctKeys drops empty and repeated keys
+func distinctKeys(keys ...string) []string {
+	var distinct []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, key)
+		}
+	}
+	return distinct
+}
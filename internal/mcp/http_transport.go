@@ -0,0 +1,548 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP headers defined by the Streamable HTTP transport
+const (
+	SessionIDHeader       = "Mcp-Session-Id"
+	ProtocolVersionHeader = "MCP-Protocol-Version"
+)
+
+// maxRequestBodySize bounds the size of a single POSTed JSON-RPC payload
+const maxRequestBodySize = 10 << 20
+
+// DefaultSessionIdleTimeout is how long an HTTP session may go without a
+// request or an open event stream before it is removed
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
+// HTTPTransport implements the MCP Streamable HTTP transport: clients POST
+// JSON-RPC messages to a single endpoint and may open a GET event stream to
+// receive server-initiated messages. Sessions are identified by the
+// Mcp-Session-Id header assigned in the initialize response.
+type HTTPTransport struct {
+	addr     string
+	endpoint string
+	handler  SessionHandler
+
+	mu          sync.Mutex
+	sessions    map[string]*httpSession
+	done        chan struct{}
+	closed      bool
+	idleTimeout time.Duration
+}
+
+// httpSession pairs a session with the queue feeding its GET event stream
+type httpSession struct {
+	session  *Session
+	outbound chan *JSONRPCMessage
+
+	// queueMu keeps notifications from being queued once outbound is closed
+	queueMu     sync.Mutex
+	queueClosed bool
+
+	// users counts the requests and event streams using the session, which
+	// expires after being unused for the idle timeout. Guarded by the
+	// transport's mu.
+	users int
+	timer *time.Timer
+}
+
+// NewHTTPTransport creates a Streamable HTTP transport listening on addr at the given endpoint path
+func NewHTTPTransport(addr, endpoint string) *HTTPTransport {
+	return &HTTPTransport{
+		addr:     addr,
+		endpoint: endpoint,
+		sessions: make(map[string]*httpSession),
+		done:     make(chan struct{}),
+
+		idleTimeout: DefaultSessionIdleTimeout,
+	}
+}
+
+// SetSessionIdleTimeout changes how long a session may go unused before it
+// is removed; 0 keeps sessions until the client deletes them. It applies
+// from the next time a session becomes unused.
+func (t *HTTPTransport) SetSessionIdleTimeout(timeout time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.idleTimeout = timeout
+}
+
+// Handler returns the transport as an http.Handler dispatching to handler,
+// for mounting on an existing server or httptest
+func (t *HTTPTransport) Handler(handler SessionHandler) http.Handler {
+	t.handler = handler
+	return t
+}
+
+// Close terminates all sessions and ends open event streams
+func (t *HTTPTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.closed {
+		t.closed = true
+		close(t.done)
+		for _, hs := range t.sessions {
+			t.dropSession(hs)
+		}
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler
+func (t *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !originAllowed(r) {
+		http.Error(w, "Forbidden origin", http.StatusForbidden)
+		return
+	}
+
+	if v := r.Header.Get(ProtocolVersionHeader); v != "" && negotiateProtocolVersion(v) != v {
+		http.Error(w, fmt.Sprintf("Unsupported protocol version: %s", v), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		t.handlePost(w, r)
+	case http.MethodGet:
+		t.handleGet(w, r)
+	case http.MethodDelete:
+		t.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (t *HTTPTransport) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	messages, batch, err := decodeHTTPMessages(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "", newErrorResponse(nil, ErrCodeParseError, "Parse error"))
+		return
+	}
+
+	var hs *httpSession
+	initialize := len(messages) == 1 && messages[0].Method == "initialize"
+	if initialize {
+		hs = t.newSession()
+	} else {
+		var status int
+		hs, status = t.lookupSession(r)
+		if hs == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+	defer t.releaseSession(hs)
+
+	// Requests asking for progress are answered over SSE so their
+	// notifications can precede the response on the same stream
+	if !acceptsJSON(r) || (acceptsEventStream(r) && wantsProgress(messages)) {
+		t.streamPost(w, r, hs, messages, initialize)
+		return
+	}
+
+	var responses []*JSONRPCMessage
+	for _, msg := range messages {
+		if response := handleRequest(r.Context(), hs.session, t.handler, msg); response != nil {
+			responses = append(responses, response)
+		}
+	}
+
+	// A failed initialize must not leave a dangling session behind
+	if initialize && (len(responses) == 0 || responses[0].Error != nil) {
+		t.removeSession(hs.session.ID)
+	}
+
+	// Notifications and responses are acknowledged without a body
+	if len(responses) == 0 {
+		w.Header().Set(SessionIDHeader, hs.session.ID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var payload interface{} = responses[0]
+	if batch {
+		payload = responses
+	}
+	writeJSON(w, http.StatusOK, hs.session.ID, payload)
+}
+
+// streamPost answers a POST as an event stream carrying the notifications
+// related to each request followed by its response
+func (t *HTTPTransport) streamPost(w http.ResponseWriter, r *http.Request, hs *httpSession, messages []*JSONRPCMessage, initialize bool) {
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(SessionIDHeader, hs.session.ID)
+	sse.start()
+
+	ctx := withRequestNotifier(r.Context(), sse.send)
+	for _, msg := range messages {
+		if response := handleRequest(ctx, hs.session, t.handler, msg); response != nil {
+			if initialize && response.Error != nil {
+				t.removeSession(hs.session.ID)
+			}
+			if err := sse.send(response); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleGet opens an event stream carrying server-initiated messages for the session
+func (t *HTTPTransport) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "Event stream requires Accept: text/event-stream", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hs, status := t.lookupSession(r)
+	if hs == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	defer t.releaseSession(hs)
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(SessionIDHeader, hs.session.ID)
+	sse.start()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.done:
+			return
+		case <-keepAlive.C:
+			if err := sse.comment("keep-alive"); err != nil {
+				return
+			}
+		case msg, ok := <-hs.outbound:
+			if !ok {
+				return
+			}
+			if err := sse.send(msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleDelete terminates a session at the client's request
+func (t *HTTPTransport) handleDelete(w http.ResponseWriter, r *http.Request) {
+	hs, status := t.lookupSession(r)
+	if hs == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	defer t.releaseSession(hs)
+	t.removeSession(hs.session.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newSession creates a session in use by the request creating it, which
+// must release it with releaseSession
+func (t *HTTPTransport) newSession() *httpSession {
+	hs := &httpSession{
+		session:  NewSession(),
+		outbound: make(chan *JSONRPCMessage, 64),
+		users:    1,
+	}
+	hs.session.setNotifier(func(msg *JSONRPCMessage) error {
+		hs.queueMu.Lock()
+		defer hs.queueMu.Unlock()
+		if hs.queueClosed {
+			return fmt.Errorf("session %s: closed", hs.session.ID)
+		}
+		select {
+		case hs.outbound <- msg:
+			return nil
+		default:
+			return fmt.Errorf("session %s: outbound queue full", hs.session.ID)
+		}
+	})
+
+	t.mu.Lock()
+	t.sessions[hs.session.ID] = hs
+	t.mu.Unlock()
+
+	return hs
+}
+
+// lookupSession resolves the session named by the request header, returning
+// the HTTP status to report when it is missing or unknown. The session is in
+// use, and kept from expiring, until released with releaseSession.
+func (t *HTTPTransport) lookupSession(r *http.Request) (*httpSession, int) {
+	id := r.Header.Get(SessionIDHeader)
+	if id == "" {
+		return nil, http.StatusBadRequest
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hs, ok := t.sessions[id]
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+	hs.users++
+	if hs.timer != nil {
+		hs.timer.Stop()
+	}
+	return hs, 0
+}
+
+// releaseSession ends a use of a session, starting its idle timer when no
+// other request or event stream is using it
+func (t *HTTPTransport) releaseSession(hs *httpSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hs.users--
+	if hs.users > 0 || t.idleTimeout <= 0 || t.sessions[hs.session.ID] != hs {
+		return
+	}
+	if hs.timer == nil {
+		hs.timer = time.AfterFunc(t.idleTimeout, func() { t.expireSession(hs) })
+	} else {
+		hs.timer.Reset(t.idleTimeout)
+	}
+}
+
+// expireSession removes a session whose idle timer fired, unless it was put
+// back in use meanwhile
+func (t *HTTPTransport) expireSession(hs *httpSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if hs.users == 0 && t.sessions[hs.session.ID] == hs {
+		t.dropSession(hs)
+	}
+}
+
+func (t *HTTPTransport) removeSession(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if hs, ok := t.sessions[id]; ok {
+		t.dropSession(hs)
+	}
+}
+
+// dropSession removes a session and closes its outbound queue, ending its
+// event stream. t.mu must be held.
+func (t *HTTPTransport) dropSession(hs *httpSession) {
+	hs.session.setNotifier(nil)
+	delete(t.sessions, hs.session.ID)
+	if hs.timer != nil {
+		hs.timer.Stop()
+	}
+
+	hs.queueMu.Lock()
+	defer hs.queueMu.Unlock()
+	if !hs.queueClosed {
+		hs.queueClosed = true
+		close(hs.outbound)
+	}
+}
+
+// decodeHTTPMessages parses a POST body holding a single message or a batch
+func decodeHTTPMessages(body []byte) ([]*JSONRPCMessage, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var messages []*JSONRPCMessage
+		if err := json.Unmarshal(body, &messages); err != nil {
+			return nil, true, err
+		}
+		if len(messages) == 0 {
+			return nil, true, fmt.Errorf("empty batch")
+		}
+		return messages, true, nil
+	}
+
+	var msg JSONRPCMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, false, err
+	}
+	return []*JSONRPCMessage{&msg}, false, nil
+}
+
+// acceptsJSON reports whether the client accepts a plain JSON response.
+// Clients that only accept text/event-stream receive responses as SSE.
+func acceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return accept == "" || strings.Contains(accept, "application/json") || strings.Contains(accept, "*/*")
+}
+
+// acceptsEventStream reports whether the client accepts a text/event-stream response
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// wantsProgress reports whether any request asks for progress notifications
+func wantsProgress(messages []*JSONRPCMessage) bool {
+	for _, msg := range messages {
+		if msg.ID != nil && progressToken(msg) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed guards against DNS rebinding by rejecting browser requests
+// whose Origin does not match the host they were sent to
+func originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+
+	host := u.Hostname()
+	reqHost, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		reqHost = r.Host
+	}
+	return isLoopback(host) && isLoopback(reqHost)
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, sessionID string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if sessionID != "" {
+		w.Header().Set(SessionIDHeader, sessionID)
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// sseWriter writes JSON-RPC messages as server-sent events
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	mu      sync.Mutex
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming not supported")
+	}
+	return &sseWriter{w: w, flusher: flusher}, nil
+}
+
+func (s *sseWriter) start() {
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+}
+
+func (s *sseWriter) send(msg *JSONRPCMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := fmt.Fprintf(s.w, "event: message\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseWriter) comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Serve listens on the transport's address until ctx is canceled
+func (t *HTTPTransport) Serve(ctx context.Context, handler SessionHandler) error {
+	mux := http.NewServeMux()
+	mux.Handle(t.endpoint, t.Handler(handler))
+
+	srv := &http.Server{
+		Addr:              t.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Close event streams first so Shutdown does not wait on them
+	t.Close()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	return nil
+}
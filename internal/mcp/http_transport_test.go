@@ -0,0 +1,306 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postMCP(t *testing.T, url, sessionID, accept, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if sessionID != "" {
+		req.Header.Set(SessionIDHeader, sessionID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
+
+func TestHTTPTransport(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	transport := server.HTTPHandler()
+	defer transport.Close()
+	ts := httptest.NewServer(transport)
+	defer ts.Close()
+
+	const accept = "application/json, text/event-stream"
+
+	// Initialize creates a session
+	resp := postMCP(t, ts.URL, "", accept,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`)
+	resp.Body.Close()
+	sessionID := resp.Header.Get(SessionIDHeader)
+	if resp.StatusCode != http.StatusOK || sessionID == "" {
+		t.Fatalf("Expected 200 with session ID, got %d %q", resp.StatusCode, sessionID)
+	}
+
+	// Notifications are accepted without a body
+	resp = postMCP(t, ts.URL, sessionID, accept, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected 202 for notification, got %d", resp.StatusCode)
+	}
+
+	// Requests without or with an unknown session are refused
+	resp = postMCP(t, ts.URL, "", accept, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without session, got %d", resp.StatusCode)
+	}
+	resp = postMCP(t, ts.URL, "unknown", accept, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown session, got %d", resp.StatusCode)
+	}
+
+	// Requests on the session get a JSON response
+	resp = postMCP(t, ts.URL, sessionID, accept, `{"jsonrpc":"2.0","id":3,"method":"tools/list"}`)
+	var msg struct {
+		Result ListToolsResult `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/json" || len(msg.Result.Tools) == 0 {
+		t.Errorf("Expected JSON tools list, got %s %+v", resp.Header.Get("Content-Type"), msg)
+	}
+
+	// Clients accepting only SSE receive the response as an event
+	resp = postMCP(t, ts.URL, sessionID, "text/event-stream", `{"jsonrpc":"2.0","id":4,"method":"ping"}`)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" || !strings.Contains(string(body), `data: {"jsonrpc":"2.0","id":4`) {
+		t.Errorf("Expected SSE response, got %s %q", resp.Header.Get("Content-Type"), body)
+	}
+
+	// Server-initiated messages are delivered on the GET stream
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(SessionIDHeader, sessionID)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET stream failed: %v", err)
+	}
+	if stream.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for GET stream, got %d", stream.StatusCode)
+	}
+
+	transport.mu.Lock()
+	sess := transport.sessions[sessionID].session
+	transport.mu.Unlock()
+	if err := sess.Notify("notifications/message", map[string]string{"level": "info", "data": "hello"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stream.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	select {
+	case line := <-lines:
+		for line == "event: message" {
+			line = <-lines
+		}
+		if !strings.Contains(line, "notifications/message") {
+			t.Errorf("Expected notification on stream, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Timed out waiting for notification")
+	}
+	stream.Body.Close()
+
+	// Browser requests from foreign origins are refused
+	req, _ = http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{"jsonrpc":"2.0","id":5,"method":"ping"}`))
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set(SessionIDHeader, sessionID)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for foreign origin, got %d", resp.StatusCode)
+	}
+
+	// DELETE terminates the session
+	req, _ = http.NewRequest(http.MethodDelete, ts.URL, nil)
+	req.Header.Set(SessionIDHeader, sessionID)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 for DELETE, got %d", resp.StatusCode)
+	}
+	resp = postMCP(t, ts.URL, sessionID, accept, `{"jsonrpc":"2.0","id":6,"method":"ping"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 after DELETE, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPProgressStream(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	transport := server.HTTPHandler()
+	defer transport.Close()
+	ts := httptest.NewServer(transport)
+	defer ts.Close()
+
+	const accept = "application/json, text/event-stream"
+
+	resp := postMCP(t, ts.URL, "", accept,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`)
+	resp.Body.Close()
+	sessionID := resp.Header.Get(SessionIDHeader)
+	resp = postMCP(t, ts.URL, sessionID, accept, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	resp.Body.Close()
+
+	// A request with a progress token is answered over SSE, chunks first
+	resp = postMCP(t, ts.URL, sessionID, accept, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{
+		"_meta":{"progressToken":"rows"},
+		"name":"db/query",
+		"arguments":{"database_name":"test","stream":true,"chunk_size":500,
+			"query":"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1200) SELECT x FROM c"}}}`)
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected SSE response, got %s", resp.Header.Get("Content-Type"))
+	}
+
+	var methods []string
+	var final *JSONRPCMessage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var msg JSONRPCMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("Failed to parse event %q: %v", data, err)
+		}
+		if msg.ID != nil {
+			final = &msg
+			break
+		}
+		methods = append(methods, msg.Method)
+	}
+
+	want := []string{"notifications/result_chunk", "notifications/result_chunk", "notifications/progress", "notifications/result_chunk"}
+	if strings.Join(methods, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected notifications %v, got %v", want, methods)
+	}
+	if final == nil || final.Error != nil {
+		t.Fatalf("Expected final response, got %+v", final)
+	}
+	if text := final.Result.(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})["text"].(string); !strings.Contains(text, `"row_count":1200`) {
+		t.Errorf("Expected row count in final result, got %s", text)
+	}
+}
+
+func TestHTTPSessionIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	transport := server.HTTPHandler()
+	transport.SetSessionIdleTimeout(50 * time.Millisecond)
+	defer transport.Close()
+	ts := httptest.NewServer(transport)
+	defer ts.Close()
+
+	const accept = "application/json, text/event-stream"
+	resp := postMCP(t, ts.URL, "", accept,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`)
+	resp.Body.Close()
+	sessionID := resp.Header.Get(SessionIDHeader)
+	transport.mu.Lock()
+	hs := transport.sessions[sessionID]
+	transport.mu.Unlock()
+
+	// An open event stream keeps the session alive
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(SessionIDHeader, sessionID)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET stream failed: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	resp = postMCP(t, ts.URL, sessionID, accept, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the session to outlive the idle timeout while streaming, got %d", resp.StatusCode)
+	}
+
+	// Once unused for the timeout it is removed and its queue closed
+	stream.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp = postMCP(t, ts.URL, sessionID, accept, `{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the idle session to expire, got %d", resp.StatusCode)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	select {
+	case _, ok := <-hs.outbound:
+		if ok {
+			t.Error("Expected the outbound queue to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the outbound queue to be closed")
+	}
+	if err := hs.session.Notify("notifications/message", map[string]string{"data": "late"}); err != nil {
+		t.Errorf("Expected notifying an expired session to be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Protocol revisions this server understands, newest first
+var supportedProtocolVersions = []string{
+	"2025-06-18",
+	"2025-03-26",
+	"2024-11-05",
+}
+
+// LatestProtocolVersion is the protocol revision offered when the client asks for one we do not support
+var LatestProtocolVersion = supportedProtocolVersions[0]
+
+// ServerName is reported to clients in serverInfo during initialization
+const ServerName = "sqlite-mcp-server"
+
+// ServerVersion is reported to clients in serverInfo; override at build time with -ldflags
+var ServerVersion = "dev"
+
+// Implementation describes a client or server implementation
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams are sent by the client in the initialize request
+type InitializeParams struct {
+	ProtocolVersion string          `json:"protocolVersion"`
+	Capabilities    json.RawMessage `json:"capabilities,omitempty"`
+	ClientInfo      Implementation  `json:"clientInfo"`
+}
+
+// InitializeResult is returned to the client in response to initialize
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// ServerCapabilities advertises the features supported by the server
+type ServerCapabilities struct {
+	Tools     *ListChangedCapability `json:"tools,omitempty"`
+	Resources *ResourcesCapability   `json:"resources,omitempty"`
+	Prompts   *ListChangedCapability `json:"prompts,omitempty"`
+	Logging   *struct{}              `json:"logging,omitempty"`
+}
+
+// ListChangedCapability is shared by capabilities that may notify on list changes
+type ListChangedCapability struct {
+	ListChanged bool `json:"listChanged"`
+}
+
+// ResourcesCapability advertises resource features
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe"`
+	ListChanged bool `json:"listChanged"`
+}
+
+const serverInstructions = `This server exposes registered SQLite databases. ` +
+	`Use db/list_databases to discover databases, then pass "database_name" to the other db/* tools.`
+
+type sessionState int
+
+const (
+	sessionNew sessionState = iota
+	sessionInitializing
+	sessionReady
+)
+
+// Session tracks the lifecycle negotiated with a single client
+type Session struct {
+	ID string
+
+	mu              sync.RWMutex
+	state           sessionState
+	protocolVersion string
+	clientInfo      Implementation
+	logLevel        string // empty until the client calls logging/setLevel
+	notifier        func(*JSONRPCMessage) error
+	requests        map[string]*inFlightRequest
+}
+
+// NewSession creates a session awaiting initialization
+func NewSession() *Session {
+	return &Session{ID: uuid.New().String(), state: sessionNew}
+}
+
+// setNotifier installs the function used by the transport to deliver server-initiated messages
+func (s *Session) setNotifier(notifier func(*JSONRPCMessage) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = notifier
+}
+
+// Notify sends a notification to the client. It is a no-op when the
+// transport has no channel for server-initiated messages.
+func (s *Session) Notify(method string, params interface{}) error {
+	s.mu.RLock()
+	notifier := s.notifier
+	s.mu.RUnlock()
+
+	if notifier == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %v", err)
+	}
+	return notifier(&JSONRPCMessage{
+		Version: "2.0",
+		Method:  method,
+		Params:  data,
+	})
+}
+
+// ProtocolVersion returns the negotiated protocol revision, empty before initialization
+func (s *Session) ProtocolVersion() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.protocolVersion
+}
+
+// ClientInfo returns the implementation details sent by the client
+func (s *Session) ClientInfo() Implementation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientInfo
+}
+
+// Initialized reports whether the initialize request has completed
+func (s *Session) Initialized() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state != sessionNew
+}
+
+// negotiateProtocolVersion returns the requested revision when supported, otherwise the latest one
+func negotiateProtocolVersion(requested string) string {
+	for _, v := range supportedProtocolVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return LatestProtocolVersion
+}
+
+// initialize handles the initialize request and moves the session out of its initial state
+func (s *Session) initialize(msg *JSONRPCMessage) *JSONRPCMessage {
+	var params InitializeParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, fmt.Sprintf("Invalid params: %v", err))
+	}
+	if params.ProtocolVersion == "" {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid params: protocolVersion is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != sessionNew {
+		return newErrorResponse(msg.ID, ErrCodeInvalidRequest, "Session already initialized")
+	}
+
+	s.state = sessionInitializing
+	s.protocolVersion = negotiateProtocolVersion(params.ProtocolVersion)
+	s.clientInfo = params.ClientInfo
+
+	return newResultResponse(msg.ID, InitializeResult{
+		ProtocolVersion: s.protocolVersion,
+		Capabilities: ServerCapabilities{
+			Tools:     &ListChangedCapability{},
+			Resources: &ResourcesCapability{},
+			Prompts:   &ListChangedCapability{},
+			Logging:   &struct{}{},
+		},
+		ServerInfo: Implementation{
+			Name:    ServerName,
+			Version: ServerVersion,
+		},
+		Instructions: serverInstructions,
+	})
+}
+
+// markReady records the client's notifications/initialized
+func (s *Session) markReady() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == sessionInitializing {
+		s.state = sessionReady
+	}
+}
+
+// setLogLevel handles logging/setLevel
+func (s *Session) setLogLevel(msg *JSONRPCMessage) *JSONRPCMessage {
+	var params struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid params: unknown log level")
+	}
+	if _, ok := logSeverities[params.Level]; !ok {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid params: unknown log level")
+	}
+
+	s.mu.Lock()
+	s.logLevel = params.Level
+	s.mu.Unlock()
+
+	return newResultResponse(msg.ID, struct{}{})
+}
+
+// logSeverities ranks the syslog severities defined by the MCP logging utility
+var logSeverities = map[string]int{
+	"debug":     0,
+	"info":      1,
+	"notice":    2,
+	"warning":   3,
+	"error":     4,
+	"critical":  5,
+	"alert":     6,
+	"emergency": 7,
+}
+
+// LogMessageParams are the params of notifications/message
+type LogMessageParams struct {
+	Level  string      `json:"level"`
+	Logger string      `json:"logger,omitempty"`
+	Data   interface{} `json:"data"`
+}
+
+// log sends a notifications/message about the request running under ctx
+// when level is at least the one the client set with logging/setLevel.
+// Nothing is sent before the client sets a level.
+func (s *Session) log(ctx context.Context, level string, data interface{}) error {
+	s.mu.RLock()
+	minimum := s.logLevel
+	s.mu.RUnlock()
+
+	if minimum == "" || logSeverities[level] < logSeverities[minimum] {
+		return nil
+	}
+	return s.notifyRequest(ctx, "notifications/message", LogMessageParams{Level: level, Logger: ServerName, Data: data})
+}
@@ -0,0 +1,153 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ListenerTransport accepts connections on a Unix domain socket or TCP
+// listener and serves each connection as its own session, exchanging
+// newline-delimited JSON-RPC messages like the STDIO transport.
+type ListenerTransport struct {
+	network string
+	address string
+
+	mu       sync.Mutex
+	listener net.Listener
+	ready    chan struct{}
+}
+
+// NewUnixTransport creates a transport listening on the Unix domain socket at path
+func NewUnixTransport(path string) *ListenerTransport {
+	return &ListenerTransport{network: "unix", address: path, ready: make(chan struct{})}
+}
+
+// NewTCPTransport creates a transport listening on the TCP address addr
+func NewTCPTransport(addr string) *ListenerTransport {
+	return &ListenerTransport{network: "tcp", address: addr, ready: make(chan struct{})}
+}
+
+// NewListenerTransport creates a transport serving connections from an existing listener
+func NewListenerTransport(listener net.Listener) *ListenerTransport {
+	t := &ListenerTransport{
+		network:  listener.Addr().Network(),
+		address:  listener.Addr().String(),
+		listener: listener,
+		ready:    make(chan struct{}),
+	}
+	close(t.ready)
+	return t
+}
+
+// ParseListenAddress creates a socket transport from an address of the form
+// unix:/path/to/socket or tcp:host:port. A bare absolute path is a Unix socket.
+func ParseListenAddress(spec string) (*ListenerTransport, error) {
+	switch {
+	case strings.HasPrefix(spec, "unix:"):
+		return NewUnixTransport(strings.TrimPrefix(strings.TrimPrefix(spec, "unix:"), "//")), nil
+	case strings.HasPrefix(spec, "tcp:"):
+		return NewTCPTransport(strings.TrimPrefix(strings.TrimPrefix(spec, "tcp:"), "//")), nil
+	case strings.HasPrefix(spec, "/"):
+		return NewUnixTransport(spec), nil
+	default:
+		return nil, fmt.Errorf("invalid listen address %q: expected unix:/path or tcp:host:port", spec)
+	}
+}
+
+// Addr returns the listening address once Serve has started listening, or
+// nil if Serve failed to listen
+func (t *ListenerTransport) Addr() net.Addr {
+	<-t.ready
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Addr()
+}
+
+// Serve accepts connections until ctx is canceled, then drains and closes every open connection
+func (t *ListenerTransport) Serve(ctx context.Context, handler SessionHandler) error {
+	listener, err := t.listen()
+	if err != nil {
+		return err
+	}
+	if t.network == "unix" {
+		defer os.Remove(t.address)
+	}
+
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := NewStreamTransport(conn).Serve(ctx, handler); err != nil && ctx.Err() == nil {
+				log.Printf("Connection %s closed with error: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (t *ListenerTransport) listen() (net.Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.listener != nil {
+		return t.listener, nil
+	}
+	// Release Addr callers whether or not listening succeeds
+	defer func() {
+		select {
+		case <-t.ready:
+		default:
+			close(t.ready)
+		}
+	}()
+
+	if t.network == "unix" {
+		// Remove a socket left behind by a previous run, but never a regular file
+		if fi, err := os.Stat(t.address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(t.address); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	listener, err := net.Listen(t.network, t.address)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.network == "unix" {
+		// The socket grants full access to the registry, keep it private to the user
+		if err := os.Chmod(t.address, 0600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	t.listener = listener
+	return listener, nil
+}
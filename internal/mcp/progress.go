@@ -0,0 +1,93 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/progress"
+)
+
+// ProgressParams are the params of notifications/progress
+type ProgressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      float64         `json:"progress"`
+	Total         float64         `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// ResultChunkParams are the params of notifications/result_chunk, which
+// carries part of a streamed tool result ahead of the final response
+type ResultChunkParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Chunk         interface{}     `json:"chunk"`
+}
+
+type requestNotifierKey struct{}
+
+// withRequestNotifier returns a context whose notifications are delivered on
+// the same channel as the response to the request, such as the SSE stream of
+// an HTTP POST. Result chunks can only be streamed on such a channel.
+func withRequestNotifier(ctx context.Context, notifier func(*JSONRPCMessage) error) context.Context {
+	return context.WithValue(ctx, requestNotifierKey{}, notifier)
+}
+
+// notifyRequest sends a notification related to the request running under
+// ctx, falling back to the session's channel for server-initiated messages
+func (s *Session) notifyRequest(ctx context.Context, method string, params interface{}) error {
+	notifier, ok := ctx.Value(requestNotifierKey{}).(func(*JSONRPCMessage) error)
+	if !ok {
+		return s.Notify(method, params)
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return notifier(&JSONRPCMessage{Version: "2.0", Method: method, Params: data})
+}
+
+// progressToken returns the _meta.progressToken of a request, or nil
+func progressToken(msg *JSONRPCMessage) json.RawMessage {
+	var params struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil
+	}
+	if len(params.Meta.ProgressToken) == 0 || string(params.Meta.ProgressToken) == "null" {
+		return nil
+	}
+	return params.Meta.ProgressToken
+}
+
+// withProgress attaches a progress tracker to ctx when the request carries a
+// progress token, so handlers can report progress and stream result chunks
+func (s *Session) withProgress(ctx context.Context, msg *JSONRPCMessage) context.Context {
+	token := progressToken(msg)
+	if token == nil {
+		return ctx
+	}
+
+	report := func(current, total float64, message string) error {
+		return s.notifyRequest(ctx, "notifications/progress", ProgressParams{
+			ProgressToken: token,
+			Progress:      current,
+			Total:         total,
+			Message:       message,
+		})
+	}
+
+	var chunk func(data interface{}) error
+	if _, ok := ctx.Value(requestNotifierKey{}).(func(*JSONRPCMessage) error); ok {
+		chunk = func(data interface{}) error {
+			return s.notifyRequest(ctx, "notifications/result_chunk", ResultChunkParams{
+				ProgressToken: token,
+				Chunk:         data,
+			})
+		}
+	}
+
+	return progress.NewContext(ctx, progress.New(report, chunk))
+}
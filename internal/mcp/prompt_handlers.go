@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Prompt describes a prompt advertised through prompts/list
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptArgument describes an argument accepted by a prompt
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptMessage is a single message of a prompts/get result
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// GetPromptResult is returned by prompts/get for static prompts
+type GetPromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// ListPromptsResult is returned by prompts/list
+type ListPromptsResult struct {
+	Prompts    []Prompt `json:"prompts"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// PromptHandler renders a prompt from its arguments. The result must encode
+// to the prompts/get shape: a description and a list of messages.
+type PromptHandler func(ctx context.Context, args map[string]string) (interface{}, error)
+
+type registeredPrompt struct {
+	prompt  Prompt
+	content string
+	handler PromptHandler
+}
+
+// RegisterPromptTemplate registers a prompt rendered on demand from its arguments
+func (r *CapabilityRegistry) RegisterPromptTemplate(prompt Prompt, handler PromptHandler) error {
+	if _, exists := r.prompts[prompt.Name]; exists {
+		return fmt.Errorf("prompt %s already registered", prompt.Name)
+	}
+	r.prompts[prompt.Name] = &registeredPrompt{
+		prompt:  prompt,
+		handler: handler,
+	}
+	return nil
+}
+
+// listPrompts returns the registered prompts sorted by name
+func (r *CapabilityRegistry) listPrompts() []Prompt {
+	prompts := make([]Prompt, 0, len(r.prompts))
+	for _, p := range r.prompts {
+		prompts = append(prompts, p.prompt)
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return prompts
+}
+
+func (r *CapabilityRegistry) handleListPrompts(msg *JSONRPCMessage) *JSONRPCMessage {
+	prompts := r.listPrompts()
+	start, end, next, errResp := r.listPage(msg, len(prompts))
+	if errResp != nil {
+		return errResp
+	}
+	return newResultResponse(msg.ID, ListPromptsResult{Prompts: prompts[start:end], NextCursor: next})
+}
+
+func (r *CapabilityRegistry) handleGetPrompt(ctx context.Context, msg *JSONRPCMessage) *JSONRPCMessage {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments,omitempty"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid params")
+	}
+
+	p, ok := r.prompts[params.Name]
+	if !ok {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, fmt.Sprintf("Unknown prompt: %s", params.Name))
+	}
+
+	for _, arg := range p.prompt.Arguments {
+		if arg.Required && params.Arguments[arg.Name] == "" {
+			return newErrorResponse(msg.ID, ErrCodeInvalidParams, fmt.Sprintf("Missing required argument: %s", arg.Name))
+		}
+	}
+
+	if p.handler == nil {
+		return newResultResponse(msg.ID, GetPromptResult{
+			Description: p.prompt.Description,
+			Messages: []PromptMessage{{
+				Role:    "user",
+				Content: Content{Type: "text", Text: p.content},
+			}},
+		})
+	}
+
+	args := params.Arguments
+	if args == nil {
+		args = map[string]string{}
+	}
+
+	result, err := p.handler(ctx, args)
+	if err != nil {
+		return newErrorResponse(msg.ID, ErrCodeServerError, err.Error())
+	}
+	return newResultResponse(msg.ID, result)
+}
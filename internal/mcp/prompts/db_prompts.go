@@ -1,5 +1,15 @@
 package prompts
 
+// DBPromptDescriptions describes each of DBPrompts
+var DBPromptDescriptions = map[string]string{
+	"db/multi_database_help": "Overview of multi-database capabilities",
+	"db/register_help":       "Help for registering databases",
+	"db/query_help":          "Help text for constructing queries",
+	"db/schema_help":         "Help text for understanding schemas",
+	"db/insert_help":         "Help text for inserting records",
+	"db/batch_help":          "Help text for batches and bulk inserts",
+}
+
 // DBPrompts provides database-related MCP prompts
 var DBPrompts = map[string]string{
 	"db/multi_database_help": `
@@ -11,11 +21,22 @@ Available Tools:
 3. db/query - Execute SELECT queries on a specific database
 4. db/get_table_schema - Get table schema from a specific database
 5. db/insert_record - Insert records into a specific database
+6. db/update_records, db/delete_records, db/upsert_record - Change records selected by key or conditions
+7. db/bulk_insert - Insert many rows into a table at once
+8. db/batch - Run several statements, possibly against different databases
+9. db/begin_transaction, db/commit, db/rollback - Group calls that pass the transaction_id into one transaction
+10. db/set_connection_options - Change the journal mode, busy timeout, foreign keys and other SQLite settings of a database
 
 Available Resources:
-1. db/databases - List all registered databases
-2. db/tables - List tables in a specific database
-3. db/schema - Get full schema of a specific database
+1. sqlite://databases - List all registered databases
+2. sqlite://{database}/tables - List tables in a specific database
+3. sqlite://{database}/schema - Get full schema of a specific database
+4. sqlite://{database}/tables/{table} - Columns and indexes of a table
+5. sqlite://{database}/tables/{table}/sample - First rows of a table
+
+Available Prompts:
+1. db/analyze_table - Analyze a table using its live schema and sample rows
+2. db/write_query - Write a query for a question given the live schema
 
 All database operations require a "database_name" parameter to specify which database to use.
 `,
@@ -38,10 +59,11 @@ Guidelines:
 3. description: Optional description
 4. readonly: Set to true for read-only access
 5. owner: Database owner identifier
+6. options: Optional connection settings such as {"foreign_keys": false, "busy_timeout_ms": 10000}; change them later with db/set_connection_options
 `,
 
 	"db/query_help": `
-To query a database, use the db/query tool. This tool accepts SQL SELECT queries.
+To query a database, use the db/query tool. This tool accepts read-only SQL queries.
 
 Example:
 {
@@ -52,7 +74,7 @@ Example:
 
 Guidelines:
 1. database_name: Name of the registered database
-2. Only SELECT queries are allowed
+2. Only a single read-only statement is allowed (SELECT, WITH ... SELECT, VALUES, EXPLAIN)
 3. Use parameterized queries with ? placeholders
 4. Provide args array for parameter values
 5. Results include column names and row data
@@ -61,9 +83,9 @@ Guidelines:
 	"db/schema_help": `
 To understand database schemas:
 
-1. Use db/databases resource to list all registered databases
-2. Use db/tables resource to list tables in a specific database
-3. Use db/schema resource to get full database schema
+1. Use the sqlite://databases resource to list all registered databases
+2. Use the sqlite://{database}/tables resource to list tables in a specific database
+3. Use the sqlite://{database}/schema resource to get full database schema
 4. Use db/get_table_schema tool for specific table details
 
 Table Schema Example:
@@ -95,5 +117,49 @@ Guidelines:
 3. data: Object with column names as keys
 4. Values must match column types
 5. Returns inserted ID and rows affected
+6. Set dry_run to see the row that would be inserted without inserting it
+`,
+	"db/batch_help": `
+To load many rows into one table, use the db/bulk_insert tool. All rows are
+inserted in a single transaction, so either all of them are stored or none.
+
+Example:
+{
+  "database_name": "my_app_db",
+  "table_name": "users",
+  "columns": ["name", "email"],
+  "rows": [
+    ["John Doe", "john@example.com"],
+    ["Jane Smith", "jane@example.com"]
+  ],
+  "on_conflict": {"action": "do_nothing"}
+}
+
+Guidelines:
+1. Every row is an array of values in the order of columns
+2. on_conflict is optional; without it a duplicate key fails the whole insert
+3. {"action": "do_nothing"} skips duplicates, {"action": "update", "target": ["email"]} overwrites them
+4. Returns the number of rows affected
+5. dry_run reports the rows that would be inserted or overwritten, before and after, without changing anything
+
+To run several statements, possibly against different databases, use the db/batch tool.
+
+Example:
+{
+  "operations": [
+    {"database": "my_app_db", "query": "UPDATE users SET active = ? WHERE id = ?", "args": [0, 7]},
+    {"database": "analytics_db", "query": "SELECT COUNT(*) AS n FROM events"}
+  ]
+}
+
+Guidelines:
+1. mode "parallel" (the default) runs operations concurrently, each in its own transaction
+2. mode "sequential" runs them in order, each in its own transaction
+3. In both, a failed operation does not stop or undo the others
+4. mode "atomic" runs them in order in one transaction on a single database;
+   if any fails, all are rolled back and the later ones are not run
+5. Results are returned per operation, in request order, with success, error and rolled_back
+6. Writes to readonly databases fail with a read-only error
+7. dry_run runs the operations and reports their results and rows_affected, then rolls everything back
 `,
 }
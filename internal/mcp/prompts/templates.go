@@ -0,0 +1,228 @@
+package prompts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/db"
+)
+
+// SampleRows is the number of rows embedded per table in rendered prompts
+const SampleRows = 3
+
+// Argument describes an argument accepted by a prompt template
+type Argument struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Template describes a prompt rendered from live database state
+type Template struct {
+	Name        string
+	Description string
+	Arguments   []Argument
+	Render      func(ctx context.Context, args map[string]string) (*Result, error)
+}
+
+// TextContent is the text content of a prompt message
+type TextContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Message is a single message of a rendered prompt
+type Message struct {
+	Role    string      `json:"role"`
+	Content TextContent `json:"content"`
+}
+
+// Result is a rendered prompt, shaped like the MCP prompts/get result
+type Result struct {
+	Description string    `json:"description,omitempty"`
+	Messages    []Message `json:"messages"`
+}
+
+// DBPromptTemplates renders prompts that embed the schema and sample data of registered databases
+type DBPromptTemplates struct {
+	manager *db.Manager
+}
+
+// NewDBPromptTemplates creates a new DBPromptTemplates instance
+func NewDBPromptTemplates(manager *db.Manager) *DBPromptTemplates {
+	return &DBPromptTemplates{manager: manager}
+}
+
+// Templates returns the prompt templates backed by this instance
+func (p *DBPromptTemplates) Templates() []Template {
+	return []Template{
+		{
+			Name:        "db/analyze_table",
+			Description: "Analyze a table's structure and data using its live schema and sample rows",
+			Arguments: []Argument{
+				{Name: "database_name", Description: "Name of the registered database", Required: true},
+				{Name: "table_name", Description: "Table to analyze", Required: true},
+			},
+			Render: p.AnalyzeTable,
+		},
+		{
+			Name:        "db/write_query",
+			Description: "Write a SQL query answering a question, given the database's live schema",
+			Arguments: []Argument{
+				{Name: "database_name", Description: "Name of the registered database", Required: true},
+				{Name: "question", Description: "Question the query should answer", Required: true},
+				{Name: "tables", Description: "Comma-separated tables to include (default: all tables)"},
+			},
+			Render: p.WriteQuery,
+		},
+	}
+}
+
+// AnalyzeTable renders the db/analyze_table prompt
+func (p *DBPromptTemplates) AnalyzeTable(ctx context.Context, args map[string]string) (*Result, error) {
+	databaseName, tableName := args["database_name"], args["table_name"]
+
+	tables, err := p.loadTables(ctx, databaseName, []string{tableName})
+	if err != nil {
+		return nil, err
+	}
+	table := tables[0]
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Analyze the table %q in the SQLite database %q.\n\n", table.name, databaseName)
+	writeTable(&text, table)
+	text.WriteString("Describe what the table stores, the meaning and likely value ranges of each column, ")
+	text.WriteString("any data quality issues visible in the sample, and indexes that would help common queries. ")
+	fmt.Fprintf(&text, "Use the db/query tool with database_name %q to look at more data if needed.\n", databaseName)
+
+	return userPrompt(fmt.Sprintf("Analysis of table %s in %s", table.name, databaseName), text.String()), nil
+}
+
+// WriteQuery renders the db/write_query prompt
+func (p *DBPromptTemplates) WriteQuery(ctx context.Context, args map[string]string) (*Result, error) {
+	databaseName := args["database_name"]
+
+	var only []string
+	for _, name := range strings.Split(args["tables"], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			only = append(only, name)
+		}
+	}
+
+	tables, err := p.loadTables(ctx, databaseName, only)
+	if err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Write a SQLite query against the database %q that answers this question:\n\n%s\n\n",
+		databaseName, args["question"])
+	text.WriteString("The database has the following tables.\n\n")
+	for _, table := range tables {
+		writeTable(&text, table)
+	}
+	text.WriteString("Write a single read-only SELECT statement (CTEs are allowed) using only these tables and columns. ")
+	text.WriteString("Use ? placeholders for literal values, then run it with the db/query tool, ")
+	fmt.Fprintf(&text, "passing database_name %q and the values in args.\n", databaseName)
+
+	return userPrompt(fmt.Sprintf("Query for: %s", args["question"]), text.String()), nil
+}
+
+type tableSnapshot struct {
+	name    string
+	sql     string
+	columns []string
+	rows    []map[string]interface{}
+}
+
+// loadTables reads the CREATE statement and sample rows of the named tables, or of all tables when names is empty
+func (p *DBPromptTemplates) loadTables(ctx context.Context, databaseName string, names []string) ([]tableSnapshot, error) {
+	database, err := p.manager.GetConnection(databaseName)
+	if err != nil {
+		return nil, fmt.Errorf("database_connection_error: %w", err)
+	}
+
+	rows, err := database.QueryContext(ctx, `
+		SELECT name, sql
+		FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+
+	available := make(map[string]string)
+	var all []string
+	for rows.Next() {
+		var name, tableSQL string
+		if err := rows.Scan(&name, &tableSQL); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("db_error: %w", err)
+		}
+		available[name] = tableSQL
+		all = append(all, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+
+	if len(names) == 0 {
+		names = all
+	}
+
+	tables := make([]tableSnapshot, 0, len(names))
+	for _, name := range names {
+		tableSQL, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("table_not_found: table %q does not exist", name)
+		}
+
+		sample, err := database.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT %d", db.QuoteIdentifier(name), SampleRows))
+		if err != nil {
+			return nil, fmt.Errorf("db_error: %w", err)
+		}
+		columns, sampleRows, err := db.ScanRows(sample)
+		sample.Close()
+		if err != nil {
+			return nil, fmt.Errorf("db_error: %w", err)
+		}
+
+		tables = append(tables, tableSnapshot{name: name, sql: tableSQL, columns: columns, rows: sampleRows})
+	}
+
+	return tables, nil
+}
+
+// writeTable renders a table's CREATE statement followed by its sample rows
+func writeTable(text *strings.Builder, table tableSnapshot) {
+	fmt.Fprintf(text, "```sql\n%s;\n```\n\n", table.sql)
+	if len(table.rows) == 0 {
+		fmt.Fprintf(text, "Table %s is empty.\n\n", table.name)
+		return
+	}
+
+	fmt.Fprintf(text, "Sample rows from %s:\n\n", table.name)
+	for _, row := range table.rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			continue
+		}
+		text.Write(data)
+		text.WriteString("\n")
+	}
+	text.WriteString("\n")
+}
+
+func userPrompt(description, text string) *Result {
+	return &Result{
+		Description: description,
+		Messages: []Message{{
+			Role:    "user",
+			Content: TextContent{Type: "text", Text: text},
+		}},
+	}
+}
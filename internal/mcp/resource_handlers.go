@@ -0,0 +1,171 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Resource describes a concrete resource advertised through resources/list
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceTemplate describes a parameterized resource advertised through resources/templates/list
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents holds the contents of a resource returned by resources/read
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+// ListResourcesResult is returned by resources/list
+type ListResourcesResult struct {
+	Resources  []Resource `json:"resources"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// ListResourceTemplatesResult is returned by resources/templates/list
+type ListResourceTemplatesResult struct {
+	ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+	NextCursor        string             `json:"nextCursor,omitempty"`
+}
+
+// ReadResourceResult is returned by resources/read
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+type registeredResource struct {
+	resource Resource
+	handler  ResourceHandler
+}
+
+type registeredTemplate struct {
+	template ResourceTemplate
+	compiled *uriTemplate
+	handler  ResourceHandler
+}
+
+// RegisterResourceTemplate registers a resource whose URI carries parameters
+func (r *CapabilityRegistry) RegisterResourceTemplate(template ResourceTemplate, handler ResourceHandler) error {
+	for _, t := range r.templates {
+		if t.template.URITemplate == template.URITemplate {
+			return fmt.Errorf("resource template %s already registered", template.URITemplate)
+		}
+	}
+
+	compiled, err := parseURITemplate(template.URITemplate)
+	if err != nil {
+		return err
+	}
+
+	r.templates = append(r.templates, &registeredTemplate{
+		template: template,
+		compiled: compiled,
+		handler:  handler,
+	})
+	return nil
+}
+
+// listResources returns the registered concrete resources sorted by URI
+func (r *CapabilityRegistry) listResources() []Resource {
+	resources := make([]Resource, 0, len(r.resources))
+	for _, res := range r.resources {
+		resources = append(resources, res.resource)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].URI < resources[j].URI })
+	return resources
+}
+
+func (r *CapabilityRegistry) handleListResources(msg *JSONRPCMessage) *JSONRPCMessage {
+	resources := r.listResources()
+	start, end, next, errResp := r.listPage(msg, len(resources))
+	if errResp != nil {
+		return errResp
+	}
+	return newResultResponse(msg.ID, ListResourcesResult{Resources: resources[start:end], NextCursor: next})
+}
+
+func (r *CapabilityRegistry) handleListResourceTemplates(msg *JSONRPCMessage) *JSONRPCMessage {
+	templates := make([]ResourceTemplate, 0, len(r.templates))
+	for _, t := range r.templates {
+		templates = append(templates, t.template)
+	}
+
+	start, end, next, errResp := r.listPage(msg, len(templates))
+	if errResp != nil {
+		return errResp
+	}
+	return newResultResponse(msg.ID, ListResourceTemplatesResult{ResourceTemplates: templates[start:end], NextCursor: next})
+}
+
+func (r *CapabilityRegistry) handleReadResource(ctx context.Context, msg *JSONRPCMessage) *JSONRPCMessage {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil || params.URI == "" {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid params: uri is required")
+	}
+
+	handler, uriParams, mimeType, ok := r.resolveResource(params.URI)
+	if !ok {
+		return resourceNotFound(msg.ID, params.URI)
+	}
+
+	result, err := handler(ctx, uriParams)
+	if err != nil {
+		return newErrorResponse(msg.ID, ErrCodeServerError, err.Error())
+	}
+
+	text, ok := result.(string)
+	if !ok {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return newErrorResponse(msg.ID, ErrCodeInternalError, fmt.Sprintf("failed to encode resource: %v", err))
+		}
+		text = string(data)
+	}
+
+	return newResultResponse(msg.ID, ReadResourceResult{
+		Contents: []ResourceContents{{
+			URI:      params.URI,
+			MimeType: mimeType,
+			Text:     text,
+		}},
+	})
+}
+
+// resolveResource finds the handler for a URI, trying concrete resources before templates
+func (r *CapabilityRegistry) resolveResource(uri string) (ResourceHandler, map[string]string, string, bool) {
+	for _, res := range r.resources {
+		if res.resource.URI == uri {
+			return res.handler, map[string]string{}, res.resource.MimeType, true
+		}
+	}
+
+	for _, t := range r.templates {
+		if params, ok := t.compiled.match(uri); ok {
+			return t.handler, params, t.template.MimeType, true
+		}
+	}
+
+	return nil, nil, "", false
+}
+
+func resourceNotFound(id *json.RawMessage, uri string) *JSONRPCMessage {
+	response := newErrorResponse(id, ErrCodeResourceNotFound, "Resource not found")
+	response.Error.Data = map[string]string{"uri": uri}
+	return response
+}
@@ -1,9 +1,12 @@
 package resources
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 
+	"github.com/nipunap/sqlite-mcp-server/internal/cursor"
 	"github.com/nipunap/sqlite-mcp-server/internal/db"
 )
 
@@ -17,9 +20,12 @@ func NewDBResources(manager *db.Manager) *DBResources {
 	return &DBResources{manager: manager}
 }
 
+// SampleSize is the number of rows returned by the table sample resource
+const SampleSize = 10
+
 // GetDatabases returns a list of all registered databases
-func (r *DBResources) GetDatabases() (interface{}, error) {
-	databases, err := r.manager.Registry.ListDatabases()
+func (r *DBResources) GetDatabases(ctx context.Context, params map[string]string) (interface{}, error) {
+	databases, err := r.manager.ListDatabases()
 	if err != nil {
 		return nil, fmt.Errorf("registry_error: %w", err)
 	}
@@ -29,21 +35,79 @@ func (r *DBResources) GetDatabases() (interface{}, error) {
 	}, nil
 }
 
+// DatabaseRequest holds the parameters of tools that operate on a whole database
+type DatabaseRequest struct {
+	DatabaseName string `json:"database_name" description:"Name of the registered database"`
+}
+
+// TablesRequest holds the parameters of db/get_tables
+type TablesRequest struct {
+	DatabaseRequest
+	PageSize int    `json:"page_size,omitempty" description:"Return at most this many tables and a nextCursor for the rest"`
+	Cursor   string `json:"cursor,omitempty" description:"nextCursor from a previous page"`
+}
+
+// TablesResponse describes the result of db/get_tables
+type TablesResponse struct {
+	Database   string      `json:"database"`
+	Tables     []TableInfo `json:"tables" description:"Tables on this page, sorted by name"`
+	NextCursor string      `json:"nextCursor,omitempty" description:"Cursor of the next page"`
+}
+
+// TableInfo describes a table
+type TableInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	SQL  string `json:"sql" description:"CREATE TABLE statement"`
+}
+
 // GetTables returns a list of all tables for a specific database
-func (r *DBResources) GetTables(params json.RawMessage) (interface{}, error) {
-	var req struct {
-		DatabaseName string `json:"database_name"`
-	}
+func (r *DBResources) GetTables(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req TablesRequest
 	if err := json.Unmarshal(params, &req); err != nil {
 		return nil, fmt.Errorf("invalid_params: %w", err)
 	}
 
-	database, err := r.manager.GetConnection(req.DatabaseName)
+	tables, err := r.tables(ctx, req.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, next, err := cursor.Page(len(tables), req.Cursor, req.PageSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid_cursor: %w", err)
+	}
+
+	response := map[string]interface{}{
+		"database": req.DatabaseName,
+		"tables":   tables[start:end],
+	}
+	if next != "" {
+		response["nextCursor"] = next
+	}
+	return response, nil
+}
+
+// ReadTables serves the sqlite://{database}/tables resource
+func (r *DBResources) ReadTables(ctx context.Context, params map[string]string) (interface{}, error) {
+	tables, err := r.tables(ctx, params["database"])
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"database": params["database"],
+		"tables":   tables,
+	}, nil
+}
+
+func (r *DBResources) tables(ctx context.Context, databaseName string) ([]map[string]interface{}, error) {
+	database, err := r.manager.GetConnection(databaseName)
 	if err != nil {
 		return nil, fmt.Errorf("database_connection_error: %w", err)
 	}
 
-	rows, err := database.Query(`
+	rows, err := database.QueryContext(ctx, `
 		SELECT
 			name,
 			type,
@@ -57,7 +121,7 @@ func (r *DBResources) GetTables(params json.RawMessage) (interface{}, error) {
 	}
 	defer rows.Close()
 
-	var tables []map[string]interface{}
+	tables := []map[string]interface{}{}
 	for rows.Next() {
 		var name, typ, sql string
 		if err := rows.Scan(&name, &typ, &sql); err != nil {
@@ -70,29 +134,48 @@ func (r *DBResources) GetTables(params json.RawMessage) (interface{}, error) {
 			"sql":  sql,
 		})
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
 
-	return map[string]interface{}{
-		"database": req.DatabaseName,
-		"tables":   tables,
-	}, nil
+	return tables, nil
+}
+
+// SchemaResponse describes the result of db/get_schema
+type SchemaResponse struct {
+	Database string                 `json:"database"`
+	Schema   map[string]TableSchema `json:"schema" description:"Tables keyed by name"`
+}
+
+// TableSchema describes a table and its indexes
+type TableSchema struct {
+	SQL     string            `json:"sql" description:"CREATE TABLE statement"`
+	Indexes map[string]string `json:"indexes" description:"CREATE INDEX statements keyed by index name"`
 }
 
 // GetSchema returns the full database schema for a specific database
-func (r *DBResources) GetSchema(params json.RawMessage) (interface{}, error) {
-	var req struct {
-		DatabaseName string `json:"database_name"`
-	}
+func (r *DBResources) GetSchema(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req DatabaseRequest
 	if err := json.Unmarshal(params, &req); err != nil {
 		return nil, fmt.Errorf("invalid_params: %w", err)
 	}
 
-	database, err := r.manager.GetConnection(req.DatabaseName)
+	return r.schema(ctx, req.DatabaseName)
+}
+
+// ReadSchema serves the sqlite://{database}/schema resource
+func (r *DBResources) ReadSchema(ctx context.Context, params map[string]string) (interface{}, error) {
+	return r.schema(ctx, params["database"])
+}
+
+func (r *DBResources) schema(ctx context.Context, databaseName string) (interface{}, error) {
+	database, err := r.manager.GetConnection(databaseName)
 	if err != nil {
 		return nil, fmt.Errorf("database_connection_error: %w", err)
 	}
 
 	// Query all tables and their schemas
-	rows, err := database.Query(`
+	rows, err := database.QueryContext(ctx, `
 		SELECT
 			m.name as table_name,
 			m.sql as table_sql,
@@ -130,7 +213,135 @@ func (r *DBResources) GetSchema(params json.RawMessage) (interface{}, error) {
 	}
 
 	return map[string]interface{}{
-		"database": req.DatabaseName,
+		"database": databaseName,
 		"schema":   schema,
 	}, nil
 }
+
+// ReadTable serves the sqlite://{database}/tables/{table} resource with the
+// table's CREATE statement, columns and indexes
+func (r *DBResources) ReadTable(ctx context.Context, params map[string]string) (interface{}, error) {
+	databaseName, tableName := params["database"], params["table"]
+
+	database, err := r.manager.GetConnection(databaseName)
+	if err != nil {
+		return nil, fmt.Errorf("database_connection_error: %w", err)
+	}
+
+	tableSQL, err := lookupTable(ctx, database, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	columnRows, err := database.QueryContext(ctx, `
+		SELECT name, type, "notnull", dflt_value, pk
+		FROM pragma_table_info(?)
+		ORDER BY cid
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+	defer columnRows.Close()
+
+	var columns []map[string]interface{}
+	for columnRows.Next() {
+		var name, typ string
+		var notnull, pk int
+		var dfltValue interface{}
+		if err := columnRows.Scan(&name, &typ, &notnull, &dfltValue, &pk); err != nil {
+			return nil, fmt.Errorf("db_error: %w", err)
+		}
+
+		columns = append(columns, map[string]interface{}{
+			"name":        name,
+			"type":        typ,
+			"nullable":    notnull == 0,
+			"default":     dfltValue,
+			"primary_key": pk > 0,
+		})
+	}
+	if err := columnRows.Err(); err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+
+	indexRows, err := database.QueryContext(ctx, `
+		SELECT name, sql
+		FROM sqlite_master
+		WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL
+		ORDER BY name
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+	defer indexRows.Close()
+
+	indexes := make(map[string]string)
+	for indexRows.Next() {
+		var name, indexSQL string
+		if err := indexRows.Scan(&name, &indexSQL); err != nil {
+			return nil, fmt.Errorf("db_error: %w", err)
+		}
+		indexes[name] = indexSQL
+	}
+	if err := indexRows.Err(); err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+
+	return map[string]interface{}{
+		"database": databaseName,
+		"table":    tableName,
+		"sql":      tableSQL,
+		"columns":  columns,
+		"indexes":  indexes,
+	}, nil
+}
+
+// ReadTableSample serves the sqlite://{database}/tables/{table}/sample resource
+// with the first SampleSize rows of the table
+func (r *DBResources) ReadTableSample(ctx context.Context, params map[string]string) (interface{}, error) {
+	databaseName, tableName := params["database"], params["table"]
+
+	database, err := r.manager.GetConnection(databaseName)
+	if err != nil {
+		return nil, fmt.Errorf("database_connection_error: %w", err)
+	}
+
+	if _, err := lookupTable(ctx, database, tableName); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT %d", db.QuoteIdentifier(tableName), SampleSize))
+	if err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+	defer rows.Close()
+
+	columns, sample, err := db.ScanRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+
+	return map[string]interface{}{
+		"database": databaseName,
+		"table":    tableName,
+		"columns":  columns,
+		"rows":     sample,
+	}, nil
+}
+
+// lookupTable returns the CREATE statement of a table or view, failing if it does not exist
+func lookupTable(ctx context.Context, database *sql.DB, tableName string) (string, error) {
+	var tableSQL string
+	err := database.QueryRowContext(ctx, `
+		SELECT sql
+		FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name = ?
+	`, tableName).Scan(&tableSQL)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("table_not_found: table %q does not exist", tableName)
+	}
+	if err != nil {
+		return "", fmt.Errorf("db_error: %w", err)
+	}
+	return tableSQL, nil
+}
@@ -1,7 +1,9 @@
 package resources
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
@@ -94,7 +96,7 @@ func TestGetTables(t *testing.T) {
 	resources := NewDBResources(manager)
 
 	params := []byte(`{"database_name": "test"}`)
-	result, err := resources.GetTables(params)
+	result, err := resources.GetTables(context.Background(), params)
 	if err != nil {
 		t.Errorf("GetTables failed: %v", err)
 	}
@@ -124,6 +126,26 @@ func TestGetTables(t *testing.T) {
 	if !tableNames["users"] || !tableNames["posts"] {
 		t.Error("Missing expected tables 'users' and/or 'posts'")
 	}
+
+	// Tables can be listed a page at a time
+	result, err = resources.GetTables(context.Background(), []byte(`{"database_name": "test", "page_size": 1}`))
+	if err != nil {
+		t.Fatalf("GetTables with page_size failed: %v", err)
+	}
+	response = result.(map[string]interface{})
+	next, ok := response["nextCursor"].(string)
+	if len(response["tables"].([]map[string]interface{})) != 1 || !ok {
+		t.Fatalf("Expected one table and a cursor, got %v", response)
+	}
+	params, _ = json.Marshal(map[string]interface{}{"database_name": "test", "page_size": 1, "cursor": next})
+	result, err = resources.GetTables(context.Background(), params)
+	if err != nil {
+		t.Fatalf("GetTables with cursor failed: %v", err)
+	}
+	response = result.(map[string]interface{})
+	if len(response["tables"].([]map[string]interface{})) != 1 || response["nextCursor"] != nil {
+		t.Errorf("Expected the last table without a cursor, got %v", response)
+	}
 }
 
 func TestGetSchema(t *testing.T) {
@@ -135,7 +157,7 @@ func TestGetSchema(t *testing.T) {
 	resources := NewDBResources(manager)
 
 	params := []byte(`{"database_name": "test"}`)
-	result, err := resources.GetSchema(params)
+	result, err := resources.GetSchema(context.Background(), params)
 	if err != nil {
 		t.Errorf("GetSchema failed: %v", err)
 	}
@@ -171,3 +193,64 @@ func TestGetSchema(t *testing.T) {
 		t.Error("Missing posts table in schema")
 	}
 }
+
+func TestReadTable(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	resources := NewDBResources(manager)
+
+	result, err := resources.ReadTable(context.Background(), map[string]string{"database": "test", "table": "posts"})
+	if err != nil {
+		t.Fatalf("ReadTable failed: %v", err)
+	}
+
+	response := result.(map[string]interface{})
+	columns := response["columns"].([]map[string]interface{})
+	if len(columns) != 4 {
+		t.Errorf("Expected 4 columns, got %d", len(columns))
+	}
+	if columns[0]["name"] != "id" || columns[0]["primary_key"] != true {
+		t.Errorf("Expected id primary key as first column, got %v", columns[0])
+	}
+
+	indexes := response["indexes"].(map[string]string)
+	if _, ok := indexes["idx_posts_user_id"]; !ok {
+		t.Error("Missing expected index 'idx_posts_user_id'")
+	}
+
+	if _, err := resources.ReadTable(context.Background(), map[string]string{"database": "test", "table": "missing"}); err == nil {
+		t.Error("Expected error for non-existent table, got nil")
+	}
+}
+
+func TestReadTableSample(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := manager.ExecuteUpdate(ctx, "test", `CREATE TABLE "odd ""name"" table" (v INTEGER)`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 0; i < SampleSize+5; i++ {
+		if _, err := manager.ExecuteUpdate(ctx, "test", `INSERT INTO "odd ""name"" table" (v) VALUES (?)`, i); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	resources := NewDBResources(manager)
+
+	result, err := resources.ReadTableSample(ctx, map[string]string{"database": "test", "table": `odd "name" table`})
+	if err != nil {
+		t.Fatalf("ReadTableSample failed: %v", err)
+	}
+
+	rows := result.(map[string]interface{})["rows"].([]map[string]interface{})
+	if len(rows) != SampleSize {
+		t.Errorf("Expected %d sample rows, got %d", SampleSize, len(rows))
+	}
+}
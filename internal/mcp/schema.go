@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// JSONSchema is the subset of JSON Schema used to describe tool inputs and outputs
+type JSONSchema struct {
+	Type        string                 `json:"type,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	Enum        []string               `json:"enum,omitempty"`
+
+	AdditionalProperties *JSONSchema `json:"additionalProperties,omitempty"`
+}
+
+// SchemaFor derives a JSON Schema from a Go value, typically a tool's request
+// or response struct.
+//
+// Field names come from the json tag, fields without omitempty are required,
+// and the optional description and enum tags document each property:
+//
+//	DatabaseName string `json:"database_name" description:"Name of the registered database"`
+//	Format       string `json:"format,omitempty" enum:"json,table"`
+//
+// A nil value yields an empty object schema, and a *JSONSchema is returned as is.
+func SchemaFor(v interface{}) *JSONSchema {
+	if v == nil {
+		return &JSONSchema{Type: "object"}
+	}
+	if schema, ok := v.(*JSONSchema); ok {
+		return schema
+	}
+	return schemaForType(reflect.TypeOf(v))
+}
+
+func schemaForType(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &JSONSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaForType(t.Elem())}
+	case reflect.Map:
+		schema := &JSONSchema{Type: "object"}
+		if values := schemaForType(t.Elem()); values.Type != "" {
+			schema.AdditionalProperties = values
+		}
+		return schema
+	case reflect.Struct:
+		return schemaForStruct(t)
+	default:
+		// interface{} and anything else accepts any JSON value
+		return &JSONSchema{}
+	}
+}
+
+func schemaForStruct(t reflect.Type) *JSONSchema {
+	schema := &JSONSchema{
+		Type:       "object",
+		Properties: make(map[string]*JSONSchema),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omitempty, skip := parseJSONTag(field)
+		if skip {
+			continue
+		}
+
+		// Embedded structs without a name contribute their fields inline
+		if field.Anonymous && name == "" {
+			embedded := schemaForType(field.Type)
+			for propName, prop := range embedded.Properties {
+				schema.Properties[propName] = prop
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := schemaForType(field.Type)
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop.Description = desc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			prop.Enum = strings.Split(enum, ",")
+		}
+
+		schema.Properties[name] = prop
+		if !omitempty {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+func parseJSONTag(field reflect.StructField) (name string, omitempty, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" || opt == "omitzero" {
+			omitempty = true
+		}
+	}
+	return parts[0], omitempty, false
+}
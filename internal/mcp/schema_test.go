@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaFor(t *testing.T) {
+	type request struct {
+		DatabaseName string                 `json:"database_name" description:"Database to use"`
+		Limit        int                    `json:"limit,omitempty"`
+		Ratio        float64                `json:"ratio,omitempty"`
+		Args         []interface{}          `json:"args,omitempty"`
+		Data         map[string]interface{} `json:"data"`
+		Format       string                 `json:"format,omitempty" enum:"json,table"`
+		Ignored      string                 `json:"-"`
+		internal     string
+	}
+
+	schema := SchemaFor(request{})
+	if schema.Type != "object" {
+		t.Fatalf("Expected object schema, got %s", schema.Type)
+	}
+
+	expectedTypes := map[string]string{
+		"database_name": "string",
+		"limit":         "integer",
+		"ratio":         "number",
+		"args":          "array",
+		"data":          "object",
+		"format":        "string",
+	}
+	if len(schema.Properties) != len(expectedTypes) {
+		t.Errorf("Expected %d properties, got %d", len(expectedTypes), len(schema.Properties))
+	}
+	for name, typ := range expectedTypes {
+		prop, ok := schema.Properties[name]
+		if !ok {
+			t.Errorf("Missing property %s", name)
+			continue
+		}
+		if prop.Type != typ {
+			t.Errorf("Expected %s to have type %s, got %s", name, typ, prop.Type)
+		}
+	}
+
+	if schema.Properties["database_name"].Description != "Database to use" {
+		t.Errorf("Expected description from tag, got %q", schema.Properties["database_name"].Description)
+	}
+	if !reflect.DeepEqual(schema.Properties["format"].Enum, []string{"json", "table"}) {
+		t.Errorf("Expected enum from tag, got %v", schema.Properties["format"].Enum)
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"database_name", "data"}) {
+		t.Errorf("Expected required [database_name data], got %v", schema.Required)
+	}
+
+	if empty := SchemaFor(nil); empty.Type != "object" || len(empty.Properties) != 0 {
+		t.Errorf("Expected empty object schema for nil, got %+v", empty)
+	}
+}
+
+// checkSchema reports where a decoded JSON value does not match schema,
+// including properties the schema does not declare
+func checkSchema(schema *JSONSchema, value interface{}, path string) []string {
+	var problems []string
+	switch schema.Type {
+	case "":
+		return nil
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %T", path, value)}
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %s", path, name))
+			}
+		}
+		for name, v := range obj {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				prop = schema.AdditionalProperties
+			}
+			if prop == nil {
+				if schema.Properties != nil {
+					problems = append(problems, fmt.Sprintf("%s: undeclared property %s", path, name))
+				}
+				continue
+			}
+			problems = append(problems, checkSchema(prop, v, path+"."+name)...)
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %T", path, value)}
+		}
+		for i, v := range arr {
+			if schema.Items != nil {
+				problems = append(problems, checkSchema(schema.Items, v, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected string, got %T", path, value))
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			problems = append(problems, fmt.Sprintf("%s: expected integer, got %v", path, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected number, got %T", path, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected boolean, got %T", path, value))
+		}
+	}
+	return problems
+}
@@ -2,6 +2,8 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/nipunap/sqlite-mcp-server/internal/db"
 	"github.com/nipunap/sqlite-mcp-server/internal/mcp/prompts"
@@ -13,56 +15,241 @@ import (
 type Server struct {
 	manager   *db.Manager
 	registry  *CapabilityRegistry
-	transport *STDIOTransport
+	transport Transport
+	session   *Session
+	workers   chan struct{}
+	dbTools   *tools.DBTools
 }
 
+// Annotations shared by the db/* tools. None of them reach beyond the
+// registered databases, so none is open-world.
+var (
+	// readOnlyTool only reads, so repeating a call has no effect
+	readOnlyTool = ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true}
+	// additiveTool writes new data without changing or removing existing data
+	additiveTool = ToolAnnotations{}
+	// destructiveTool changes or removes existing data
+	destructiveTool = ToolAnnotations{DestructiveHint: true}
+	// upsertTool overwrites existing data, but repeating a call changes nothing more
+	upsertTool = ToolAnnotations{DestructiveHint: true, IdempotentHint: true}
+)
+
 // NewServer creates a new MCP server instance
 func NewServer(manager *db.Manager) (*Server, error) {
 	s := &Server{
 		manager:   manager,
 		registry:  NewCapabilityRegistry(),
 		transport: NewSTDIOTransport(),
+		session:   NewSession(),
+		workers:   make(chan struct{}, DefaultMaxWorkers),
 	}
 
 	// Initialize components
 	dbTools := tools.NewDBTools(manager)
+	s.dbTools = dbTools
 	dbResources := resources.NewDBResources(manager)
 
 	// Register database management tools
-	if err := s.registry.RegisterTool("db/register_database", dbTools.RegisterDatabase, nil); err != nil {
+	if err := s.registry.RegisterTool("db/register_database", ToolMetadata{
+		Title:       "Register database",
+		Description: "Register a SQLite database file so it can be used by the other db/* tools",
+		Annotations: &additiveTool,
+	}, dbTools.RegisterDatabase, tools.RegisterDatabaseRequest{}, tools.RegisterDatabaseResponse{}); err != nil {
 		return nil, err
 	}
-	if err := s.registry.RegisterTool("db/list_databases", dbTools.ListDatabases, nil); err != nil {
+	if err := s.registry.RegisterTool("db/list_databases", ToolMetadata{
+		Title:       "List databases",
+		Description: "List all registered databases",
+		Annotations: &readOnlyTool,
+	}, dbTools.ListDatabases, tools.ListDatabasesRequest{}, tools.ListDatabasesResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/set_connection_options", ToolMetadata{
+		Title:       "Set connection options",
+		Description: "Change the journal mode, busy timeout, foreign key enforcement and other SQLite settings of a database and reopen its connections",
+		Annotations: &upsertTool,
+	}, dbTools.SetConnectionOptions, tools.SetConnectionOptionsRequest{}, tools.SetConnectionOptionsResponse{}); err != nil {
 		return nil, err
 	}
 
 	// Register database operation tools
-	if err := s.registry.RegisterTool("db/get_table_schema", dbTools.GetTableSchema, nil); err != nil {
+	if err := s.registry.RegisterTool("db/get_table_schema", ToolMetadata{
+		Title:       "Get table schema",
+		Description: "Get the columns, indexes and CREATE statement of a table",
+		Annotations: &readOnlyTool,
+	}, dbTools.GetTableSchema, tools.GetTableSchemaRequest{}, tools.TableSchemaResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/insert_record", ToolMetadata{
+		Title:       "Insert record",
+		Description: "Insert a single record into a table",
+		Annotations: &additiveTool,
+	}, dbTools.InsertRecord, tools.InsertRecordRequest{}, tools.InsertRecordResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/update_records", ToolMetadata{
+		Title:       "Update records",
+		Description: "Update the records of a table selected by primary key or column conditions",
+		Annotations: &destructiveTool,
+	}, dbTools.UpdateRecords, tools.UpdateRecordsRequest{}, tools.WriteRecordsResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/delete_records", ToolMetadata{
+		Title:       "Delete records",
+		Description: "Delete the records of a table selected by primary key or column conditions",
+		Annotations: &destructiveTool,
+	}, dbTools.DeleteRecords, tools.DeleteRecordsRequest{}, tools.WriteRecordsResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/upsert_record", ToolMetadata{
+		Title:       "Upsert record",
+		Description: "Insert a record, or update the existing record with the same primary key or unique columns",
+		Annotations: &upsertTool,
+	}, dbTools.UpsertRecord, tools.UpsertRecordRequest{}, tools.WriteRecordsResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/bulk_insert", ToolMetadata{
+		Title:       "Bulk insert",
+		Description: "Insert many rows into a table in a single transaction",
+		Annotations: &destructiveTool,
+	}, dbTools.BulkInsert, tools.BulkInsertRequest{}, tools.BulkInsertResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/batch", ToolMetadata{
+		Title:       "Run batch",
+		Description: "Run several SQL statements, possibly against different databases, and report the outcome of each",
+		Annotations: &destructiveTool,
+	}, dbTools.Batch, tools.BatchRequest{}, tools.BatchResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/begin_transaction", ToolMetadata{
+		Title:       "Begin transaction",
+		Description: "Open a transaction whose transaction_id later db/query and record tool calls can pass; it is rolled back when left unused",
+		Annotations: &additiveTool,
+	}, dbTools.BeginTransaction, tools.BeginTransactionRequest{}, tools.TransactionResponse{}); err != nil {
 		return nil, err
 	}
-	if err := s.registry.RegisterTool("db/insert_record", dbTools.InsertRecord, nil); err != nil {
+	if err := s.registry.RegisterTool("db/commit", ToolMetadata{
+		Title:       "Commit transaction",
+		Description: "Commit a transaction opened by db/begin_transaction",
+		Annotations: &destructiveTool,
+	}, dbTools.Commit, tools.TransactionRequest{}, tools.TransactionResponse{}); err != nil {
 		return nil, err
 	}
-	if err := s.registry.RegisterTool("db/query", dbTools.ExecuteQuery, nil); err != nil {
+	if err := s.registry.RegisterTool("db/rollback", ToolMetadata{
+		Title:       "Roll back transaction",
+		Description: "Roll back a transaction, or only the changes made since one of its savepoints",
+		Annotations: &destructiveTool,
+	}, dbTools.Rollback, tools.RollbackRequest{}, tools.TransactionResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/savepoint", ToolMetadata{
+		Title:       "Create savepoint",
+		Description: "Start a savepoint inside a transaction that db/rollback can return to",
+		Annotations: &additiveTool,
+	}, dbTools.Savepoint, tools.SavepointRequest{}, tools.TransactionResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/release_savepoint", ToolMetadata{
+		Title:       "Release savepoint",
+		Description: "Keep the changes made since a savepoint and forget the savepoint",
+		Annotations: &additiveTool,
+	}, dbTools.ReleaseSavepoint, tools.SavepointRequest{}, tools.TransactionResponse{}); err != nil {
+		return nil, err
+	}
+	if err := s.registry.RegisterTool("db/query", ToolMetadata{
+		Title:       "Query database",
+		Description: "Run a read-only SQL query and return the matching rows",
+		Annotations: &readOnlyTool,
+	}, dbTools.ExecuteQuery, tools.ExecuteQueryRequest{}, tools.QueryResponse{}); err != nil {
 		return nil, err
 	}
 
 	// Register database query tools (previously resources, but they need parameters)
-	if err := s.registry.RegisterTool("db/get_tables", dbResources.GetTables, nil); err != nil {
+	if err := s.registry.RegisterTool("db/get_tables", ToolMetadata{
+		Title:       "List tables",
+		Description: "List the tables of a database with their CREATE statements",
+		Annotations: &readOnlyTool,
+	}, dbResources.GetTables, resources.TablesRequest{}, resources.TablesResponse{}); err != nil {
 		return nil, err
 	}
-	if err := s.registry.RegisterTool("db/get_schema", dbResources.GetSchema, nil); err != nil {
+	if err := s.registry.RegisterTool("db/get_schema", ToolMetadata{
+		Title:       "Get database schema",
+		Description: "Get the full schema of a database including indexes",
+		Annotations: &readOnlyTool,
+	}, dbResources.GetSchema, resources.DatabaseRequest{}, resources.SchemaResponse{}); err != nil {
 		return nil, err
 	}
 
-	// Register resources (no parameters needed)
-	if err := s.registry.RegisterResource("db/databases", dbResources.GetDatabases); err != nil {
+	// Register resources
+	if err := s.registry.RegisterResource(Resource{
+		URI:         "sqlite://databases",
+		Name:        "db/databases",
+		Description: "All registered databases",
+		MimeType:    "application/json",
+	}, dbResources.GetDatabases); err != nil {
 		return nil, err
 	}
 
+	// Register resource templates addressing individual databases and tables
+	resourceTemplates := []struct {
+		template ResourceTemplate
+		handler  ResourceHandler
+	}{
+		{ResourceTemplate{
+			URITemplate: "sqlite://{database}/schema",
+			Name:        "db/schema",
+			Description: "Full schema of a database including indexes",
+			MimeType:    "application/json",
+		}, dbResources.ReadSchema},
+		{ResourceTemplate{
+			URITemplate: "sqlite://{database}/tables",
+			Name:        "db/tables",
+			Description: "Tables of a database with their CREATE statements",
+			MimeType:    "application/json",
+		}, dbResources.ReadTables},
+		{ResourceTemplate{
+			URITemplate: "sqlite://{database}/tables/{table}",
+			Name:        "db/table",
+			Description: "Columns, indexes and CREATE statement of a table",
+			MimeType:    "application/json",
+		}, dbResources.ReadTable},
+		{ResourceTemplate{
+			URITemplate: "sqlite://{database}/tables/{table}/sample",
+			Name:        "db/table_sample",
+			Description: "The first rows of a table",
+			MimeType:    "application/json",
+		}, dbResources.ReadTableSample},
+	}
+	for _, rt := range resourceTemplates {
+		if err := s.registry.RegisterResourceTemplate(rt.template, rt.handler); err != nil {
+			return nil, err
+		}
+	}
+
 	// Register prompts
 	for name, content := range prompts.DBPrompts {
-		if err := s.registry.RegisterPrompt(name, content); err != nil {
+		if err := s.registry.RegisterPrompt(name, prompts.DBPromptDescriptions[name], content); err != nil {
+			return nil, err
+		}
+	}
+
+	// Register prompt templates rendered from live schema
+	for _, tmpl := range prompts.NewDBPromptTemplates(manager).Templates() {
+		prompt := Prompt{Name: tmpl.Name, Description: tmpl.Description}
+		for _, arg := range tmpl.Arguments {
+			prompt.Arguments = append(prompt.Arguments, PromptArgument{
+				Name:        arg.Name,
+				Description: arg.Description,
+				Required:    arg.Required,
+			})
+		}
+
+		render := tmpl.Render
+		handler := func(ctx context.Context, args map[string]string) (interface{}, error) {
+			return render(ctx, args)
+		}
+		if err := s.registry.RegisterPromptTemplate(prompt, handler); err != nil {
 			return nil, err
 		}
 	}
@@ -70,12 +257,126 @@ func NewServer(manager *db.Manager) (*Server, error) {
 	return s, nil
 }
 
-// Run starts the MCP server
+// SetTransport replaces the transport used by Run, which defaults to STDIO
+func (s *Server) SetTransport(transport Transport) {
+	s.transport = transport
+}
+
+// SetMaxWorkers limits how many requests execute at once across all sessions.
+// It must be called before the server starts serving.
+func (s *Server) SetMaxWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.workers = make(chan struct{}, n)
+}
+
+// SetQueryTimeout changes how long db/query may run when a call sets no
+// timeout_ms. Zero disables the default timeout.
+func (s *Server) SetQueryTimeout(timeout time.Duration) {
+	s.dbTools.SetQueryTimeout(timeout)
+}
+
+// Run starts the MCP server on its transport
 func (s *Server) Run(ctx context.Context) error {
-	return s.transport.HandleMessages(ctx, s.handleMessage)
+	return s.Serve(ctx, s.transport)
+}
+
+// Serve runs the MCP server on the given transport until ctx is canceled.
+// All transports share the server's capabilities.
+func (s *Server) Serve(ctx context.Context, transport Transport) error {
+	return transport.Serve(ctx, s.handleSessionMessage)
 }
 
-// handleMessage processes incoming MCP messages
+// HTTPHandler returns a Streamable HTTP handler sharing this server's capabilities
+func (s *Server) HTTPHandler() *HTTPTransport {
+	transport := NewHTTPTransport("", "")
+	transport.Handler(s.handleSessionMessage)
+	return transport
+}
+
+// handleMessage processes incoming MCP messages on the server's own session,
+// used for in-process calls
 func (s *Server) handleMessage(msg *JSONRPCMessage) *JSONRPCMessage {
-	return s.registry.HandleCapabilityRequest(msg)
+	return s.handleSessionMessage(context.Background(), s.session, msg)
+}
+
+// handleSessionMessage applies the MCP lifecycle rules before dispatching to the capability registry
+func (s *Server) handleSessionMessage(ctx context.Context, sess *Session, msg *JSONRPCMessage) *JSONRPCMessage {
+	// Notifications never receive a response
+	if msg.ID == nil {
+		s.handleNotification(sess, msg)
+		return nil
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return sess.initialize(msg)
+	case "ping":
+		return newResultResponse(msg.ID, struct{}{})
+	}
+
+	if !sess.Initialized() {
+		return newErrorResponse(msg.ID, ErrCodeInvalidRequest, "Server not initialized")
+	}
+
+	if msg.Method == "logging/setLevel" {
+		return sess.setLogLevel(msg)
+	}
+
+	// Capability requests do the actual database work, bound them by the worker limit
+	select {
+	case s.workers <- struct{}{}:
+		defer func() { <-s.workers }()
+	case <-ctx.Done():
+		return newErrorResponse(msg.ID, ErrCodeServerError, "Request cancelled")
+	}
+
+	start := time.Now()
+	response := s.registry.HandleCapabilityRequest(sess.withProgress(ctx, msg), msg)
+	logResponse(ctx, sess, msg, response, time.Since(start))
+	return response
+}
+
+// logResponse reports a handled request to the client: failures at error
+// level, everything else at debug level
+func logResponse(ctx context.Context, sess *Session, msg *JSONRPCMessage, response *JSONRPCMessage, elapsed time.Duration) {
+	entry := map[string]interface{}{
+		"method":      msg.Method,
+		"duration_ms": elapsed.Milliseconds(),
+	}
+	var params struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(msg.Params, &params) == nil && params.Name != "" {
+		entry["name"] = params.Name
+	}
+
+	level := "debug"
+	switch {
+	case response == nil:
+	case response.Error != nil:
+		level, entry["error"] = "error", response.Error.Message
+	default:
+		if result, ok := response.Result.(CallToolResult); ok && result.IsError && len(result.Content) > 0 {
+			level, entry["error"] = "error", result.Content[0].Text
+		}
+	}
+	sess.log(ctx, level, entry)
+}
+
+// handleNotification processes client notifications
+func (s *Server) handleNotification(sess *Session, msg *JSONRPCMessage) {
+	switch msg.Method {
+	case "notifications/initialized":
+		sess.markReady()
+	case "notifications/cancelled":
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason,omitempty"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err == nil && len(params.RequestID) > 0 {
+			sess.cancelRequest(params.RequestID)
+		}
+	}
 }
@@ -1,9 +1,11 @@
 package mcp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -44,14 +46,8 @@ func setupTestManager(t *testing.T) (*db.Manager, func()) {
 		t.Fatalf("Failed to register test database: %v", err)
 	}
 
-	// Get connection and create test table with timeout
-	conn, err := manager.GetConnection("test")
-	if err != nil {
-		t.Fatalf("Failed to get connection: %v", err)
-	}
-
 	// Create test table with simple structure
-	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS test_table (id INTEGER PRIMARY KEY, name TEXT)`)
+	_, err = manager.ExecuteUpdate(context.Background(), "test", `CREATE TABLE IF NOT EXISTS test_table (id INTEGER PRIMARY KEY, name TEXT)`)
 	if err != nil {
 		t.Fatalf("Failed to create test table: %v", err)
 	}
@@ -80,6 +76,8 @@ func TestServerCapabilities(t *testing.T) {
 		t.Fatalf("Failed to create server: %v", err)
 	}
 
+	initializeServer(t, server)
+
 	// Test capabilities method (this should be fast and not require database operations)
 	id1 := json.RawMessage(`"1"`)
 	msg := &JSONRPCMessage{
@@ -154,6 +152,8 @@ func TestServerErrorHandling(t *testing.T) {
 		t.Fatalf("Failed to create server: %v", err)
 	}
 
+	initializeServer(t, server)
+
 	// Test invalid method
 	id1 := json.RawMessage(`"1"`)
 	msg := &JSONRPCMessage{
@@ -195,3 +195,558 @@ func TestServerErrorHandling(t *testing.T) {
 	// This is acceptable behavior for an MCP server
 	t.Logf("JSON-RPC version test response: %+v", response)
 }
+
+// initializeServer performs the initialize handshake on the server's STDIO session
+func initializeServer(t *testing.T, server *Server) {
+	t.Helper()
+
+	id := json.RawMessage(`"init"`)
+	response := server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id,
+		Method:  "initialize",
+		Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+	})
+	if response == nil || response.Error != nil {
+		t.Fatalf("Initialize failed: %+v", response)
+	}
+
+	if resp := server.handleMessage(&JSONRPCMessage{Version: "2.0", Method: "notifications/initialized"}); resp != nil {
+		t.Fatalf("Expected no response to notification, got %+v", resp)
+	}
+}
+
+func TestServerInitialize(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	// Requests before initialization are rejected
+	id1 := json.RawMessage(`1`)
+	response := server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id1,
+		Method:  "tools/list",
+	})
+	if response.Error == nil || response.Error.Code != ErrCodeInvalidRequest {
+		t.Errorf("Expected not initialized error, got %+v", response)
+	}
+
+	// So are the legacy methods, which would otherwise run tools without a handshake
+	for _, legacy := range []JSONRPCMessage{
+		{Method: "capabilities"},
+		{Method: "invoke", Params: json.RawMessage(`{"name": "db/list_databases", "params": {}}`)},
+	} {
+		legacy.Version, legacy.ID = "2.0", &id1
+		response = server.handleMessage(&legacy)
+		if response.Error == nil || response.Error.Code != ErrCodeInvalidRequest {
+			t.Errorf("Expected not initialized error for %s, got %+v", legacy.Method, response)
+		}
+	}
+
+	// Ping is allowed at any time
+	id2 := json.RawMessage(`2`)
+	response = server.handleMessage(&JSONRPCMessage{Version: "2.0", ID: &id2, Method: "ping"})
+	if response.Error != nil {
+		t.Errorf("Ping failed: %v", response.Error)
+	}
+
+	// Unsupported versions negotiate down to the latest supported revision
+	id3 := json.RawMessage(`3`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id3,
+		Method:  "initialize",
+		Params:  json.RawMessage(`{"protocolVersion": "1999-01-01", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+	})
+	if response.Error != nil {
+		t.Fatalf("Initialize failed: %v", response.Error)
+	}
+
+	result := response.Result.(InitializeResult)
+	if result.ProtocolVersion != LatestProtocolVersion {
+		t.Errorf("Expected protocol version %s, got %s", LatestProtocolVersion, result.ProtocolVersion)
+	}
+	if result.ServerInfo.Name != ServerName {
+		t.Errorf("Expected server name %s, got %s", ServerName, result.ServerInfo.Name)
+	}
+	if result.Capabilities.Tools == nil || result.Capabilities.Resources == nil ||
+		result.Capabilities.Prompts == nil || result.Capabilities.Logging == nil {
+		t.Errorf("Expected tools, resources, prompts and logging capabilities, got %+v", result.Capabilities)
+	}
+
+	// A second initialize is rejected
+	id4 := json.RawMessage(`4`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id4,
+		Method:  "initialize",
+		Params:  json.RawMessage(`{"protocolVersion": "2024-11-05", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+	})
+	if response.Error == nil {
+		t.Error("Expected error for repeated initialize, got nil")
+	}
+
+	// Log level changes are accepted once initialized
+	id5 := json.RawMessage(`5`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id5,
+		Method:  "logging/setLevel",
+		Params:  json.RawMessage(`{"level": "debug"}`),
+	})
+	if response.Error != nil {
+		t.Errorf("logging/setLevel failed: %v", response.Error)
+	}
+}
+
+func TestNegotiateProtocolVersion(t *testing.T) {
+	for _, v := range supportedProtocolVersions {
+		if got := negotiateProtocolVersion(v); got != v {
+			t.Errorf("Expected %s to be accepted, got %s", v, got)
+		}
+	}
+	if got := negotiateProtocolVersion("unknown"); got != LatestProtocolVersion {
+		t.Errorf("Expected fallback to %s, got %s", LatestProtocolVersion, got)
+	}
+}
+
+func TestToolsListAndCall(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	initializeServer(t, server)
+
+	// tools/list advertises every tool with an input schema
+	id1 := json.RawMessage(`1`)
+	response := server.handleMessage(&JSONRPCMessage{Version: "2.0", ID: &id1, Method: "tools/list"})
+	if response.Error != nil {
+		t.Fatalf("tools/list failed: %v", response.Error)
+	}
+
+	list := response.Result.(ListToolsResult)
+	var queryTool *Tool
+	for i := range list.Tools {
+		if list.Tools[i].Description == "" || list.Tools[i].InputSchema == nil {
+			t.Errorf("Tool %s is missing description or input schema", list.Tools[i].Name)
+		}
+		if list.Tools[i].Name == "db/query" {
+			queryTool = &list.Tools[i]
+		}
+	}
+	if queryTool == nil {
+		t.Fatal("db/query missing from tools/list")
+	}
+	if _, ok := queryTool.InputSchema.Properties["database_name"]; !ok {
+		t.Errorf("Expected db/query schema to declare database_name, got %+v", queryTool.InputSchema)
+	}
+
+	// Successful calls return text content
+	id2 := json.RawMessage(`2`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id2,
+		Method:  "tools/call",
+		Params:  json.RawMessage(`{"name": "db/query", "arguments": {"database_name": "test", "query": "SELECT * FROM test_table"}}`),
+	})
+	if response.Error != nil {
+		t.Fatalf("tools/call failed: %v", response.Error)
+	}
+	result := response.Result.(CallToolResult)
+	if result.IsError || len(result.Content) != 1 || result.Content[0].Type != "text" {
+		t.Errorf("Expected a single text content block, got %+v", result)
+	}
+
+	// Text formats are returned with their MIME type, followed by the metadata
+	id5 := json.RawMessage(`5`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id5,
+		Method:  "tools/call",
+		Params:  json.RawMessage(`{"name": "db/query", "arguments": {"database_name": "test", "query": "SELECT 1 AS a, 'x|y' AS b", "format": "markdown"}}`),
+	})
+	if response.Error != nil {
+		t.Fatalf("tools/call failed: %v", response.Error)
+	}
+	result = response.Result.(CallToolResult)
+	if len(result.Content) != 2 || result.Content[0].MimeType != "text/markdown" || result.Content[0].Text != "| a | b |\n| --- | --- |\n| 1 | x\\|y |\n" {
+		t.Errorf("Expected a markdown table, got %+v", result)
+	} else if result.Content[1].MimeType != "application/json" || result.Content[1].Text != `{"columns":["a","b"],"row_count":1}` {
+		t.Errorf("Expected JSON metadata, got %+v", result.Content[1])
+	}
+
+	// Tool failures are reported with isError rather than a JSON-RPC error
+	id3 := json.RawMessage(`3`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id3,
+		Method:  "tools/call",
+		Params:  json.RawMessage(`{"name": "db/query", "arguments": {"database_name": "missing", "query": "SELECT 1"}}`),
+	})
+	if response.Error != nil {
+		t.Fatalf("Expected tool error as result, got JSON-RPC error %v", response.Error)
+	}
+	if result := response.Result.(CallToolResult); !result.IsError {
+		t.Errorf("Expected isError for failing tool, got %+v", result)
+	}
+
+	// Unknown tools are a protocol error
+	id4 := json.RawMessage(`4`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id4,
+		Method:  "tools/call",
+		Params:  json.RawMessage(`{"name": "db/unknown", "arguments": {}}`),
+	})
+	if response.Error == nil || response.Error.Code != ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params error for unknown tool, got %+v", response)
+	}
+}
+
+func TestToolAnnotations(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	readOnly := map[string]bool{
+		"db/query":                  true,
+		"db/get_schema":             true,
+		"db/get_tables":             true,
+		"db/get_table_schema":       true,
+		"db/list_databases":         true,
+		"db/insert_record":          false,
+		"db/register_database":      false,
+		"db/update_records":         false,
+		"db/delete_records":         false,
+		"db/upsert_record":          false,
+		"db/bulk_insert":            false,
+		"db/batch":                  false,
+		"db/begin_transaction":      false,
+		"db/commit":                 false,
+		"db/rollback":               false,
+		"db/savepoint":              false,
+		"db/release_savepoint":      false,
+		"db/set_connection_options": false,
+	}
+	for _, tool := range server.registry.listTools() {
+		want, ok := readOnly[tool.Name]
+		if !ok {
+			continue
+		}
+		if tool.Annotations == nil || tool.Title == "" {
+			t.Errorf("Tool %s is missing a title or annotations", tool.Name)
+			continue
+		}
+		if tool.Annotations.ReadOnlyHint != want || tool.Annotations.OpenWorldHint || tool.Annotations.Title != tool.Title {
+			t.Errorf("Unexpected annotations for %s: %+v", tool.Name, tool.Annotations)
+		}
+	}
+
+	// The legacy capabilities listing carries the real descriptions
+	for _, c := range server.registry.GetCapabilities() {
+		if c.Description == "" || strings.HasPrefix(c.Description, "Tool: ") || strings.HasPrefix(c.Description, "Help text: db/") {
+			t.Errorf("Capability %s has no real description: %q", c.Name, c.Description)
+		}
+		if c.Type == "tool" && (c.Annotations == nil || c.Schema == nil) {
+			t.Errorf("Tool capability %s is missing annotations or schema", c.Name)
+		}
+	}
+}
+
+func TestStructuredToolOutput(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	initializeServer(t, server)
+
+	emptyDB := fmt.Sprintf("%s/empty.db", t.TempDir())
+	calls := []struct {
+		tool      string
+		arguments string
+	}{
+		{"db/register_database", fmt.Sprintf(`{"name": "empty", "path": %q, "owner": "test", "options": {"synchronous": "normal"}}`, emptyDB)},
+		{"db/list_databases", `{}`},
+		{"db/list_databases", `{"page_size": 1}`},
+		{"db/get_table_schema", `{"database_name": "test", "table_name": "test_table"}`},
+		{"db/insert_record", `{"database_name": "test", "table_name": "test_table", "data": {"name": "a"}}`},
+		{"db/update_records", `{"database_name": "test", "table_name": "test_table", "data": {"name": "b"}, "key": {"id": 1}, "returning": true}`},
+		{"db/upsert_record", `{"database_name": "test", "table_name": "test_table", "data": {"id": 1, "name": "c"}}`},
+		{"db/delete_records", `{"database_name": "test", "table_name": "test_table", "where": [{"column": "name", "value": "x"}]}`},
+		{"db/bulk_insert", `{"database_name": "test", "table_name": "test_table", "columns": ["name"], "rows": [["d"], ["e"]]}`},
+		{"db/batch", `{"operations": [{"database": "test", "query": "SELECT * FROM test_table", "format": "table"}, {"database": "test", "query": "SELECT * FROM missing"}]}`},
+		{"db/batch", `{"mode": "atomic", "operations": [{"database": "test", "query": "SELECT 1"}, {"database": "test", "query": "SELECT * FROM missing"}]}`},
+		{"db/update_records", `{"database_name": "test", "table_name": "test_table", "data": {"name": "z"}, "allow_all": true, "dry_run": true}`},
+		{"db/insert_record", `{"database_name": "test", "table_name": "test_table", "data": {"name": "z"}, "dry_run": true}`},
+		{"db/bulk_insert", `{"database_name": "test", "table_name": "test_table", "columns": ["name"], "rows": [["z"]], "dry_run": true}`},
+		{"db/batch", `{"operations": [{"database": "test", "query": "DELETE FROM test_table"}], "dry_run": true}`},
+		{"db/query", `{"database_name": "test", "query": "SELECT * FROM test_table"}`},
+		{"db/query", `{"database_name": "test", "query": "SELECT * FROM test_table WHERE 0"}`},
+		{"db/query", `{"database_name": "test", "query": "SELECT id, x'00' AS b FROM test_table", "format": "table", "max_rows": 1}`},
+		{"db/query", `{"database_name": "test", "query": "SELECT * FROM test_table", "format": "csv"}`},
+		{"db/get_tables", `{"database_name": "test"}`},
+		{"db/get_tables", `{"database_name": "empty"}`},
+		{"db/get_schema", `{"database_name": "test"}`},
+		{"db/set_connection_options", `{"database_name": "empty", "options": {"busy_timeout_ms": 100, "temp_store": "memory"}}`},
+		{"db/begin_transaction", `{"database_name": "empty"}`},
+	}
+
+	tools := make(map[string]Tool)
+	for _, tool := range server.registry.listTools() {
+		if tool.OutputSchema == nil {
+			t.Errorf("Tool %s declares no output schema", tool.Name)
+		}
+		tools[tool.Name] = tool
+	}
+
+	for i, call := range calls {
+		id := json.RawMessage(fmt.Sprint(i + 1))
+		response := server.handleMessage(&JSONRPCMessage{
+			Version: "2.0",
+			ID:      &id,
+			Method:  "tools/call",
+			Params:  json.RawMessage(fmt.Sprintf(`{"name": %q, "arguments": %s}`, call.tool, call.arguments)),
+		})
+		if response.Error != nil {
+			t.Fatalf("%s failed: %v", call.tool, response.Error)
+		}
+		result := response.Result.(CallToolResult)
+		if result.IsError {
+			t.Fatalf("%s %s failed: %s", call.tool, call.arguments, result.Content[0].Text)
+		}
+
+		var structured interface{}
+		if err := json.Unmarshal(result.StructuredContent, &structured); err != nil {
+			t.Fatalf("%s returned no structured content: %v", call.tool, err)
+		}
+		for _, problem := range checkSchema(tools[call.tool].OutputSchema, structured, call.tool) {
+			t.Errorf("%s %s: %s", call.tool, call.arguments, problem)
+		}
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	initializeServer(t, server)
+	server.registry.SetPageSize(3)
+
+	// tools/list pages through every tool exactly once
+	seen := map[string]bool{}
+	params := json.RawMessage(`{}`)
+	for page := 0; ; page++ {
+		id := json.RawMessage(fmt.Sprint(page))
+		response := server.handleMessage(&JSONRPCMessage{Version: "2.0", ID: &id, Method: "tools/list", Params: params})
+		if response.Error != nil {
+			t.Fatalf("tools/list failed: %v", response.Error)
+		}
+		list := response.Result.(ListToolsResult)
+		if len(list.Tools) > 3 {
+			t.Errorf("Page %d has %d tools", page, len(list.Tools))
+		}
+		for _, tool := range list.Tools {
+			if seen[tool.Name] {
+				t.Errorf("Tool %s listed twice", tool.Name)
+			}
+			seen[tool.Name] = true
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		params, _ = json.Marshal(map[string]string{"cursor": list.NextCursor})
+	}
+	if len(seen) != len(server.registry.tools) {
+		t.Errorf("Expected %d tools, saw %d", len(server.registry.tools), len(seen))
+	}
+
+	// resources/templates/list paginates the same way
+	id := json.RawMessage(`10`)
+	response := server.handleMessage(&JSONRPCMessage{Version: "2.0", ID: &id, Method: "resources/templates/list"})
+	if list := response.Result.(ListResourceTemplatesResult); len(list.ResourceTemplates) != 3 || list.NextCursor == "" {
+		t.Errorf("Expected a first page of 3 templates with a cursor, got %+v", list)
+	}
+
+	// Malformed cursors are invalid params
+	response = server.handleMessage(&JSONRPCMessage{Version: "2.0", ID: &id, Method: "resources/list", Params: json.RawMessage(`{"cursor": "bogus"}`)})
+	if response.Error == nil || response.Error.Code != ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params for a bad cursor, got %+v", response)
+	}
+}
+
+func TestResources(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	initializeServer(t, server)
+
+	id1 := json.RawMessage(`1`)
+	response := server.handleMessage(&JSONRPCMessage{Version: "2.0", ID: &id1, Method: "resources/list"})
+	if response.Error != nil {
+		t.Fatalf("resources/list failed: %v", response.Error)
+	}
+	if list := response.Result.(ListResourcesResult); len(list.Resources) == 0 || list.Resources[0].URI != "sqlite://databases" {
+		t.Errorf("Expected sqlite://databases resource, got %+v", list.Resources)
+	}
+
+	id2 := json.RawMessage(`2`)
+	response = server.handleMessage(&JSONRPCMessage{Version: "2.0", ID: &id2, Method: "resources/templates/list"})
+	if response.Error != nil {
+		t.Fatalf("resources/templates/list failed: %v", response.Error)
+	}
+	if templates := response.Result.(ListResourceTemplatesResult); len(templates.ResourceTemplates) != 4 {
+		t.Errorf("Expected 4 resource templates, got %d", len(templates.ResourceTemplates))
+	}
+
+	// Templated URIs are percent-decoded before reaching the handler
+	uris := []string{
+		"sqlite://databases",
+		"sqlite://test/schema",
+		"sqlite://test/tables",
+		"sqlite://test/tables/test_table",
+		"sqlite://test/tables/test%5Ftable/sample",
+	}
+	for i, uri := range uris {
+		id := json.RawMessage(fmt.Sprintf("%d", 10+i))
+		response = server.handleMessage(&JSONRPCMessage{
+			Version: "2.0",
+			ID:      &id,
+			Method:  "resources/read",
+			Params:  json.RawMessage(fmt.Sprintf(`{"uri": %q}`, uri)),
+		})
+		if response.Error != nil {
+			t.Errorf("resources/read %s failed: %v", uri, response.Error)
+			continue
+		}
+		contents := response.Result.(ReadResourceResult).Contents
+		if len(contents) != 1 || contents[0].URI != uri || contents[0].MimeType != "application/json" {
+			t.Errorf("Unexpected contents for %s: %+v", uri, contents)
+		}
+	}
+
+	id3 := json.RawMessage(`3`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id3,
+		Method:  "resources/read",
+		Params:  json.RawMessage(`{"uri": "sqlite://test/unknown"}`),
+	})
+	if response.Error == nil || response.Error.Code != ErrCodeResourceNotFound {
+		t.Errorf("Expected resource not found error, got %+v", response)
+	}
+}
+
+func TestPrompts(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	initializeServer(t, server)
+
+	id1 := json.RawMessage(`1`)
+	response := server.handleMessage(&JSONRPCMessage{Version: "2.0", ID: &id1, Method: "prompts/list"})
+	if response.Error != nil {
+		t.Fatalf("prompts/list failed: %v", response.Error)
+	}
+
+	var analyze *Prompt
+	list := response.Result.(ListPromptsResult)
+	for i := range list.Prompts {
+		if list.Prompts[i].Name == "db/analyze_table" {
+			analyze = &list.Prompts[i]
+		}
+	}
+	if analyze == nil || len(analyze.Arguments) != 2 {
+		t.Fatalf("Expected db/analyze_table with 2 arguments, got %+v", analyze)
+	}
+
+	// Static help prompts render as a single user message
+	id2 := json.RawMessage(`2`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id2,
+		Method:  "prompts/get",
+		Params:  json.RawMessage(`{"name": "db/query_help"}`),
+	})
+	if response.Error != nil {
+		t.Fatalf("prompts/get failed: %v", response.Error)
+	}
+	if result := response.Result.(GetPromptResult); len(result.Messages) != 1 || result.Messages[0].Content.Text == "" {
+		t.Errorf("Expected one non-empty message, got %+v", result)
+	}
+
+	// Templates embed the live schema
+	id3 := json.RawMessage(`3`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id3,
+		Method:  "prompts/get",
+		Params:  json.RawMessage(`{"name": "db/write_query", "arguments": {"database_name": "test", "question": "How many rows are there?"}}`),
+	})
+	if response.Error != nil {
+		t.Fatalf("prompts/get failed: %v", response.Error)
+	}
+	data, err := json.Marshal(response.Result)
+	if err != nil {
+		t.Fatalf("Failed to marshal prompt: %v", err)
+	}
+	var rendered GetPromptResult
+	if err := json.Unmarshal(data, &rendered); err != nil {
+		t.Fatalf("Failed to unmarshal prompt: %v", err)
+	}
+	if len(rendered.Messages) != 1 || !strings.Contains(rendered.Messages[0].Content.Text, "CREATE TABLE test_table") {
+		t.Errorf("Expected prompt to embed the test_table schema, got %+v", rendered)
+	}
+
+	// Missing required arguments are rejected
+	id4 := json.RawMessage(`4`)
+	response = server.handleMessage(&JSONRPCMessage{
+		Version: "2.0",
+		ID:      &id4,
+		Method:  "prompts/get",
+		Params:  json.RawMessage(`{"name": "db/analyze_table", "arguments": {"database_name": "test"}}`),
+	})
+	if response.Error == nil || response.Error.Code != ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params for missing argument, got %+v", response)
+	}
+}
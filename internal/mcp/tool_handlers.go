@@ -0,0 +1,162 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/mcp/tools"
+)
+
+// Tool describes a tool advertised through tools/list
+type Tool struct {
+	Name         string           `json:"name"`
+	Title        string           `json:"title,omitempty"`
+	Description  string           `json:"description,omitempty"`
+	InputSchema  *JSONSchema      `json:"inputSchema"`
+	OutputSchema *JSONSchema      `json:"outputSchema,omitempty"`
+	Annotations  *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are hints about a tool's behavior that hosts use to decide
+// whether a call needs the user's approval. Every hint is stated explicitly
+// since the MCP defaults assume the worst.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    bool   `json:"readOnlyHint"`
+	DestructiveHint bool   `json:"destructiveHint"`
+	IdempotentHint  bool   `json:"idempotentHint"`
+	OpenWorldHint   bool   `json:"openWorldHint"`
+}
+
+// ToolMetadata describes a tool to clients
+type ToolMetadata struct {
+	Title       string
+	Description string
+	Annotations *ToolAnnotations
+}
+
+// Content is a single MCP content block
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// ListToolsResult is returned by tools/list
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// CallToolResult is returned by tools/call. Tool failures are reported
+// through IsError so the model can see and react to them. Tools with an
+// output schema also return their result as StructuredContent.
+type CallToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+type registeredTool struct {
+	tool    Tool
+	handler ToolHandler
+}
+
+// listTools returns the registered tools sorted by name
+func (r *CapabilityRegistry) listTools() []Tool {
+	tools := make([]Tool, 0, len(r.tools))
+	for _, t := range r.tools {
+		tools = append(tools, t.tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+func (r *CapabilityRegistry) handleListTools(msg *JSONRPCMessage) *JSONRPCMessage {
+	tools := r.listTools()
+	start, end, next, errResp := r.listPage(msg, len(tools))
+	if errResp != nil {
+		return errResp
+	}
+	return newResultResponse(msg.ID, ListToolsResult{Tools: tools[start:end], NextCursor: next})
+}
+
+func (r *CapabilityRegistry) handleCallTool(ctx context.Context, msg *JSONRPCMessage) *JSONRPCMessage {
+	var params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments,omitempty"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, "Invalid params")
+	}
+
+	tool, ok := r.tools[params.Name]
+	if !ok {
+		return newErrorResponse(msg.ID, ErrCodeInvalidParams, fmt.Sprintf("Unknown tool: %s", params.Name))
+	}
+
+	args := params.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage(`{}`)
+	}
+
+	result, err := tool.handler(ctx, args)
+	if err != nil {
+		return newResultResponse(msg.ID, toolErrorResult(err))
+	}
+
+	return newResultResponse(msg.ID, toolResult(result, tool.tool.OutputSchema != nil))
+}
+
+// toolResult wraps a handler result in a text content block, and in
+// structured content when requested. Results rendered as text are returned
+// as is, followed by their metadata, and their structured content holds the
+// metadata together with the text.
+func toolResult(result interface{}, structured bool) CallToolResult {
+	if formatted, ok := result.(*tools.FormattedResult); ok {
+		metadata, err := json.Marshal(formatted.Metadata)
+		if err != nil {
+			return toolErrorResult(fmt.Errorf("failed to encode result: %w", err))
+		}
+		callResult := CallToolResult{
+			Content: []Content{
+				{Type: "text", Text: formatted.Text, MimeType: formatted.MimeType},
+				{Type: "text", Text: string(metadata), MimeType: "application/json"},
+			},
+		}
+		if structured {
+			content := make(map[string]interface{}, len(formatted.Metadata)+2)
+			for key, value := range formatted.Metadata {
+				content[key] = value
+			}
+			content["text"] = formatted.Text
+			content["mime_type"] = formatted.MimeType
+			if callResult.StructuredContent, err = json.Marshal(content); err != nil {
+				return toolErrorResult(fmt.Errorf("failed to encode result: %w", err))
+			}
+		}
+		return callResult
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return toolErrorResult(fmt.Errorf("failed to encode result: %w", err))
+	}
+	callResult := CallToolResult{
+		Content: []Content{{Type: "text", Text: string(data)}},
+	}
+	if structured {
+		callResult.StructuredContent = data
+	}
+	return callResult
+}
+
+// toolErrorResult reports a tool failure to the client as content
+func toolErrorResult(err error) CallToolResult {
+	return CallToolResult{
+		Content: []Content{{Type: "text", Text: err.Error()}},
+		IsError: true,
+	}
+}
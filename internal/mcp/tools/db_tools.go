@@ -1,37 +1,83 @@
 package tools
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/nipunap/sqlite-mcp-server/internal/cursor"
 	"github.com/nipunap/sqlite-mcp-server/internal/db"
+	"github.com/nipunap/sqlite-mcp-server/internal/progress"
 )
 
+// DefaultQueryTimeout bounds how long db/query may run when the call sets no timeout_ms
+const DefaultQueryTimeout = 30 * time.Second
+
+// DefaultChunkSize is the number of rows per chunk when db/query streams its result
+const DefaultChunkSize = 500
+
+// progressInterval is the number of rows read between progress updates
+const progressInterval = 1000
+
+// DefaultCursorTTL is how long an unused db/query cursor stays valid
+const DefaultCursorTTL = 10 * time.Minute
+
+// errPageFull stops reading rows once a page is complete
+var errPageFull = errors.New("page full")
+
 // DBTools provides database-related MCP tools
 type DBTools struct {
-	manager *db.Manager
+	manager      *db.Manager
+	queryTimeout time.Duration
+	cursors      *cursor.Store
 }
 
 // NewDBTools creates a new DBTools instance
 func NewDBTools(manager *db.Manager) *DBTools {
-	return &DBTools{manager: manager}
+	return &DBTools{
+		manager:      manager,
+		queryTimeout: DefaultQueryTimeout,
+		cursors:      cursor.NewStore(DefaultCursorTTL),
+	}
+}
+
+// SetQueryTimeout changes the default db/query timeout. Zero disables it.
+func (t *DBTools) SetQueryTimeout(timeout time.Duration) {
+	t.queryTimeout = timeout
+}
+
+// RegisterDatabaseRequest holds the parameters of db/register_database
+type RegisterDatabaseRequest struct {
+	Name        string `json:"name" description:"Unique name used to refer to the database"`
+	Path        string `json:"path" description:"Absolute path to the SQLite file"`
+	Description string `json:"description,omitempty" description:"Human readable description"`
+	ReadOnly    bool   `json:"readonly,omitempty" description:"Register the database for read-only access"`
+	Owner       string `json:"owner" description:"Owner identifier"`
+
+	Options db.ConnectionOptions `json:"options,omitempty" description:"Connection options; unset options follow the server defaults"`
+}
+
+// RegisterDatabaseResponse describes the result of db/register_database
+type RegisterDatabaseResponse struct {
+	ID      string `json:"id" description:"Registry ID of the database"`
+	Name    string `json:"name" description:"Name of the database"`
+	Status  string `json:"status" description:"Always registered"`
+	Message string `json:"message" description:"Human readable confirmation"`
 }
 
 // RegisterDatabase registers a new SQLite database
-func (t *DBTools) RegisterDatabase(params json.RawMessage) (interface{}, error) {
-	var req struct {
-		Name        string `json:"name"`
-		Path        string `json:"path"`
-		Description string `json:"description,omitempty"`
-		ReadOnly    bool   `json:"readonly,omitempty"`
-		Owner       string `json:"owner"`
-	}
+func (t *DBTools) RegisterDatabase(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req RegisterDatabaseRequest
 	if err := json.Unmarshal(params, &req); err != nil {
 		return nil, fmt.Errorf("invalid_params: %w", err)
 	}
+	if err := req.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
 
 	// Create database info
 	info := &db.DatabaseInfo{
@@ -42,6 +88,7 @@ func (t *DBTools) RegisterDatabase(params json.RawMessage) (interface{}, error)
 		ReadOnly:    req.ReadOnly,
 		Owner:       req.Owner,
 		Status:      "active",
+		Options:     req.Options,
 	}
 
 	// Register database
@@ -57,25 +104,126 @@ func (t *DBTools) RegisterDatabase(params json.RawMessage) (interface{}, error)
 	}, nil
 }
 
+// ListDatabasesRequest holds the parameters of db/list_databases
+type ListDatabasesRequest struct {
+	PageSize int    `json:"page_size,omitempty" description:"Return at most this many databases and a nextCursor for the rest"`
+	Cursor   string `json:"cursor,omitempty" description:"nextCursor from a previous page"`
+}
+
+// ListDatabasesResponse describes the result of db/list_databases
+type ListDatabasesResponse struct {
+	Databases  []db.DatabaseInfo `json:"databases" description:"Registered databases on this page, with the connection options each is opened with"`
+	Count      int               `json:"count" description:"Number of databases on this page"`
+	Total      int               `json:"total" description:"Number of registered databases"`
+	NextCursor string            `json:"nextCursor,omitempty" description:"Cursor of the next page"`
+}
+
 // ListDatabases lists all registered databases
-func (t *DBTools) ListDatabases(params json.RawMessage) (interface{}, error) {
-	databases, err := t.manager.Registry.ListDatabases()
+func (t *DBTools) ListDatabases(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req ListDatabasesRequest
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, fmt.Errorf("invalid_params: %w", err)
+		}
+	}
+
+	databases, err := t.manager.ListDatabases()
 	if err != nil {
 		return nil, fmt.Errorf("registry_error: %w", err)
 	}
+	if databases == nil {
+		databases = []db.DatabaseInfo{}
+	}
+
+	start, end, next, err := cursor.Page(len(databases), req.Cursor, req.PageSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid_cursor: %w", err)
+	}
+
+	response := map[string]interface{}{
+		"databases": databases[start:end],
+		"count":     end - start,
+		"total":     len(databases),
+	}
+	if next != "" {
+		response["nextCursor"] = next
+	}
+	return response, nil
+}
+
+// SetConnectionOptionsRequest holds the parameters of db/set_connection_options
+type SetConnectionOptionsRequest struct {
+	DatabaseName string               `json:"database_name" description:"Name of the registered database"`
+	Options      db.ConnectionOptions `json:"options,omitempty" description:"Options to change; unset options keep their current value"`
+	Reset        bool                 `json:"reset,omitempty" description:"Drop the options set for the database first, so unset options return to the server defaults"`
+}
+
+// SetConnectionOptionsResponse describes the result of db/set_connection_options
+type SetConnectionOptionsResponse struct {
+	DatabaseName string               `json:"database_name" description:"Name of the database"`
+	Options      db.ConnectionOptions `json:"options" description:"Options the database is opened with from now on"`
+}
+
+// SetConnectionOptions changes the connection options of a database and
+// reopens its connections with them
+func (t *DBTools) SetConnectionOptions(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req SetConnectionOptionsRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+	if err := req.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+	if _, err := t.manager.Registry.GetDatabase(req.DatabaseName); err != nil {
+		return nil, fmt.Errorf("database_connection_error: %w", err)
+	}
+
+	options, err := t.manager.SetConnectionOptions(ctx, req.DatabaseName, req.Options, req.Reset)
+	if err != nil {
+		if errors.Is(err, db.ErrTransactionActive) {
+			return nil, fmt.Errorf("transaction_active: %w", err)
+		}
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
 
 	return map[string]interface{}{
-		"databases": databases,
-		"count":     len(databases),
+		"database_name": req.DatabaseName,
+		"options":       options,
 	}, nil
 }
 
+// GetTableSchemaRequest holds the parameters of db/get_table_schema
+type GetTableSchemaRequest struct {
+	DatabaseName string `json:"database_name" description:"Name of the registered database"`
+	TableName    string `json:"table_name" description:"Table to describe"`
+}
+
+// TableSchemaResponse describes the result of db/get_table_schema
+type TableSchemaResponse struct {
+	TableName string       `json:"table_name" description:"Name of the table"`
+	Schema    string       `json:"schema" description:"CREATE TABLE statement"`
+	Columns   []ColumnInfo `json:"columns" description:"Columns in declaration order"`
+	Indexes   []IndexInfo  `json:"indexes" description:"Indexes on the table"`
+}
+
+// ColumnInfo describes a table column
+type ColumnInfo struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type" description:"Declared type, empty when none"`
+	Nullable   bool        `json:"nullable"`
+	Default    interface{} `json:"default" description:"Default value expression, null when none"`
+	PrimaryKey bool        `json:"primary_key"`
+}
+
+// IndexInfo describes an index
+type IndexInfo struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql" description:"CREATE INDEX statement"`
+}
+
 // GetTableSchema returns the schema for a specific table
-func (t *DBTools) GetTableSchema(params json.RawMessage) (interface{}, error) {
-	var req struct {
-		DatabaseName string `json:"database_name"`
-		TableName    string `json:"table_name"`
-	}
+func (t *DBTools) GetTableSchema(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req GetTableSchemaRequest
 	if err := json.Unmarshal(params, &req); err != nil {
 		return nil, fmt.Errorf("invalid_params: %w", err)
 	}
@@ -86,34 +234,28 @@ func (t *DBTools) GetTableSchema(params json.RawMessage) (interface{}, error) {
 		return nil, fmt.Errorf("database_connection_error: %w", err)
 	}
 
-	// Query table schema
-	rows, err := database.Query(`
+	// Query table schema, releasing the connection before the next queries
+	var schema string
+	err = database.QueryRowContext(ctx, `
 		SELECT sql
 		FROM sqlite_master
 		WHERE type='table' AND name=?
-	`, req.TableName)
-	if err != nil {
-		return nil, fmt.Errorf("db_error: %w", err)
-	}
-	defer rows.Close()
-
-	if !rows.Next() {
+	`, req.TableName).Scan(&schema)
+	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("table_not_found: table does not exist")
 	}
-
-	var schema string
-	if err := rows.Scan(&schema); err != nil {
+	if err != nil {
 		return nil, fmt.Errorf("db_error: %w", err)
 	}
 
 	// Get column information
-	columns, err := t.getTableColumns(database, req.TableName)
+	columns, err := t.getTableColumns(ctx, database, req.TableName)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get index information
-	indexes, err := t.getTableIndexes(database, req.TableName)
+	indexes, err := t.getTableIndexes(ctx, database, req.TableName)
 	if err != nil {
 		return nil, err
 	}
@@ -126,42 +268,63 @@ func (t *DBTools) GetTableSchema(params json.RawMessage) (interface{}, error) {
 	}, nil
 }
 
+// InsertRecordRequest holds the parameters of db/insert_record
+type InsertRecordRequest struct {
+	DatabaseName  string                 `json:"database_name" description:"Name of the registered database"`
+	TableName     string                 `json:"table_name" description:"Target table"`
+	Data          map[string]interface{} `json:"data" description:"Column names mapped to the values to insert"`
+	TransactionID string                 `json:"transaction_id,omitempty" description:"Run inside this transaction from db/begin_transaction"`
+	DryRun        bool                   `json:"dry_run,omitempty" description:"Report the changes without making them"`
+}
+
+// InsertRecordResponse describes the result of db/insert_record
+type InsertRecordResponse struct {
+	ID           int64          `json:"id" description:"Rowid of the inserted record; 0 for a dry run"`
+	RowsAffected int64          `json:"rows_affected"`
+	DryRun       bool           `json:"dry_run,omitempty" description:"Nothing was changed; changes shows what the call would do"`
+	Changes      []db.RowChange `json:"changes,omitempty" description:"Rows the call would change, for a dry run"`
+}
+
 // InsertRecord inserts a new record into a table
-func (t *DBTools) InsertRecord(params json.RawMessage) (interface{}, error) {
-	var req struct {
-		DatabaseName string                 `json:"database_name"`
-		TableName    string                 `json:"table_name"`
-		Data         map[string]interface{} `json:"data"`
-	}
+func (t *DBTools) InsertRecord(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req InsertRecordRequest
 	if err := json.Unmarshal(params, &req); err != nil {
 		return nil, fmt.Errorf("invalid_params: %w", err)
 	}
 
-	// Get database connection
-	database, err := t.manager.GetConnection(req.DatabaseName)
+	tx, err := t.useTransaction(ctx, req.DatabaseName, req.TransactionID)
 	if err != nil {
-		return nil, fmt.Errorf("database_connection_error: %w", err)
+		return nil, err
 	}
-
-	// Build insert query
-	columns := make([]string, 0, len(req.Data))
-	values := make([]interface{}, 0, len(req.Data))
-	placeholders := make([]string, 0, len(req.Data))
-
-	for col, val := range req.Data {
-		columns = append(columns, col)
-		values = append(values, val)
-		placeholders = append(placeholders, "?")
+	if tx != nil {
+		defer tx.Done()
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		req.TableName,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "))
+	table, err := t.recordTable(ctx, req.DatabaseName, req.TableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	query, values, err := table.Insert(req.Data, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+	if req.DryRun {
+		response, err := t.previewRecords(ctx, req.DatabaseName, tx, table, db.Statement{Query: query, Args: values})
+		if err != nil {
+			return nil, err
+		}
+		response["id"] = 0
+		return response, nil
+	}
 
-	result, err := database.Exec(query, values...)
+	var result sql.Result
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, values...)
+	} else {
+		result, err = t.manager.ExecuteUpdate(ctx, req.DatabaseName, query, values...)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("db_error: %w", err)
+		return nil, writeError(err)
 	}
 
 	id, _ := result.LastInsertId()
@@ -173,116 +336,708 @@ func (t *DBTools) InsertRecord(params json.RawMessage) (interface{}, error) {
 	}, nil
 }
 
-// ExecuteQuery executes a read-only SQL query
-func (t *DBTools) ExecuteQuery(params json.RawMessage) (interface{}, error) {
-	var req struct {
-		DatabaseName string        `json:"database_name"`
-		Query        string        `json:"query"`
-		Args         []interface{} `json:"args,omitempty"`
+// UpdateRecordsRequest holds the parameters of db/update_records
+type UpdateRecordsRequest struct {
+	DatabaseName  string                 `json:"database_name" description:"Name of the registered database"`
+	TableName     string                 `json:"table_name" description:"Target table"`
+	Data          map[string]interface{} `json:"data" description:"Column names mapped to their new values"`
+	Key           map[string]interface{} `json:"key,omitempty" description:"Primary key columns mapped to the values of the record to update"`
+	Where         []db.Condition         `json:"where,omitempty" description:"Conditions the records to update must all meet"`
+	AllowAll      bool                   `json:"allow_all,omitempty" description:"Update every row when neither key nor where is set"`
+	Returning     bool                   `json:"returning,omitempty" description:"Return the updated rows"`
+	TransactionID string                 `json:"transaction_id,omitempty" description:"Run inside this transaction from db/begin_transaction"`
+	DryRun        bool                   `json:"dry_run,omitempty" description:"Report the changes without making them"`
+}
+
+// DeleteRecordsRequest holds the parameters of db/delete_records
+type DeleteRecordsRequest struct {
+	DatabaseName  string                 `json:"database_name" description:"Name of the registered database"`
+	TableName     string                 `json:"table_name" description:"Target table"`
+	Key           map[string]interface{} `json:"key,omitempty" description:"Primary key columns mapped to the values of the record to delete"`
+	Where         []db.Condition         `json:"where,omitempty" description:"Conditions the records to delete must all meet"`
+	AllowAll      bool                   `json:"allow_all,omitempty" description:"Delete every row when neither key nor where is set"`
+	Returning     bool                   `json:"returning,omitempty" description:"Return the deleted rows"`
+	TransactionID string                 `json:"transaction_id,omitempty" description:"Run inside this transaction from db/begin_transaction"`
+	DryRun        bool                   `json:"dry_run,omitempty" description:"Report the changes without making them"`
+}
+
+// UpsertRecordRequest holds the parameters of db/upsert_record
+type UpsertRecordRequest struct {
+	DatabaseName    string                 `json:"database_name" description:"Name of the registered database"`
+	TableName       string                 `json:"table_name" description:"Target table"`
+	Data            map[string]interface{} `json:"data" description:"Column names mapped to the values to insert or update"`
+	ConflictColumns []string               `json:"conflict_columns,omitempty" description:"Columns of a primary key or unique constraint identifying an existing record; the primary key by default"`
+	Returning       bool                   `json:"returning,omitempty" description:"Return the inserted or updated row"`
+	TransactionID   string                 `json:"transaction_id,omitempty" description:"Run inside this transaction from db/begin_transaction"`
+	DryRun          bool                   `json:"dry_run,omitempty" description:"Report the changes without making them"`
+}
+
+// WriteRecordsResponse describes the result of db/update_records,
+// db/delete_records and db/upsert_record
+type WriteRecordsResponse struct {
+	RowsAffected   int64                    `json:"rows_affected"`
+	Rows           []map[string]interface{} `json:"rows,omitempty" description:"Affected rows, when returning is set"`
+	DryRun         bool                     `json:"dry_run,omitempty" description:"Nothing was changed; changes shows what the call would do"`
+	Changes        []db.RowChange           `json:"changes,omitempty" description:"Rows the call would change, for a dry run"`
+	Truncated      bool                     `json:"truncated,omitempty" description:"Whether rows or changes holds only part of the affected rows"`
+	Limit          string                   `json:"limit,omitempty" enum:"max_rows,max_bytes" description:"Limit that cut rows or changes short"`
+	TotalRows      *int                     `json:"total_rows,omitempty" description:"Number of affected rows when rows or changes was truncated"`
+	CellsTruncated int                      `json:"cells_truncated,omitempty" description:"Number of values shortened to max_cell_bytes"`
+}
+
+// UpdateRecords updates the records of a table selected by key or conditions
+func (t *DBTools) UpdateRecords(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req UpdateRecordsRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	tx, err := t.useTransaction(ctx, req.DatabaseName, req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		defer tx.Done()
+	}
+
+	table, err := t.recordTable(ctx, req.DatabaseName, req.TableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := table.Update(req.Data, db.Filter{Key: req.Key, Where: req.Where}, req.AllowAll, req.Returning && !req.DryRun)
+	if err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+	if req.DryRun {
+		return t.previewRecords(ctx, req.DatabaseName, tx, table, db.Statement{Query: query, Args: args})
+	}
+
+	return t.writeRecords(ctx, req.DatabaseName, tx, req.Returning, query, args)
+}
+
+// DeleteRecords deletes the records of a table selected by key or conditions
+func (t *DBTools) DeleteRecords(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req DeleteRecordsRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	tx, err := t.useTransaction(ctx, req.DatabaseName, req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		defer tx.Done()
 	}
+
+	table, err := t.recordTable(ctx, req.DatabaseName, req.TableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := table.Delete(db.Filter{Key: req.Key, Where: req.Where}, req.AllowAll, req.Returning && !req.DryRun)
+	if err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+	if req.DryRun {
+		return t.previewRecords(ctx, req.DatabaseName, tx, table, db.Statement{Query: query, Args: args})
+	}
+
+	return t.writeRecords(ctx, req.DatabaseName, tx, req.Returning, query, args)
+}
+
+// UpsertRecord inserts a record or updates the one it conflicts with
+func (t *DBTools) UpsertRecord(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req UpsertRecordRequest
 	if err := json.Unmarshal(params, &req); err != nil {
 		return nil, fmt.Errorf("invalid_params: %w", err)
 	}
 
-	// Verify query is read-only
-	if !isReadOnlyQuery(req.Query) {
-		return nil, fmt.Errorf("invalid_query: only SELECT queries are allowed")
+	tx, err := t.useTransaction(ctx, req.DatabaseName, req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		defer tx.Done()
 	}
 
-	// Get database connection
-	database, err := t.manager.GetConnection(req.DatabaseName)
+	table, err := t.recordTable(ctx, req.DatabaseName, req.TableName, tx)
 	if err != nil {
+		return nil, err
+	}
+	query, args, err := table.Upsert(req.Data, req.ConflictColumns, req.Returning && !req.DryRun)
+	if err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+	if req.DryRun {
+		return t.previewRecords(ctx, req.DatabaseName, tx, table, db.Statement{Query: query, Args: args})
+	}
+
+	return t.writeRecords(ctx, req.DatabaseName, tx, req.Returning, query, args)
+}
+
+// recordTable checks that a database is writable and describes one of its
+// tables for building record statements, as seen by tx when it is not nil
+func (t *DBTools) recordTable(ctx context.Context, databaseName, tableName string, tx *db.Transaction) (*db.Table, error) {
+	// Refuse writes to readonly databases before touching the connection
+	if err := t.manager.CheckWritable(databaseName); err != nil {
+		if errors.Is(err, db.ErrReadOnly) {
+			return nil, fmt.Errorf("readonly_error: %w", err)
+		}
 		return nil, fmt.Errorf("database_connection_error: %w", err)
 	}
 
-	// Execute query
-	rows, err := database.Query(req.Query, req.Args...)
+	var table *db.Table
+	var err error
+	if tx != nil {
+		table, err = db.LoadTable(ctx, tx, tableName)
+	} else {
+		table, err = t.manager.Table(ctx, databaseName, tableName)
+	}
 	if err != nil {
+		if errors.Is(err, db.ErrTableNotFound) {
+			return nil, fmt.Errorf("table_not_found: %w", err)
+		}
 		return nil, fmt.Errorf("db_error: %w", err)
 	}
-	defer rows.Close()
+	return table, nil
+}
+
+// writeRecords runs a record statement, inside tx when it is not nil,
+// reading the affected rows back when it has a RETURNING clause
+func (t *DBTools) writeRecords(ctx context.Context, databaseName string, tx *db.Transaction, returning bool, query string, args []interface{}) (interface{}, error) {
+	if !returning {
+		var result sql.Result
+		var err error
+		if tx != nil {
+			result, err = tx.ExecContext(ctx, query, args...)
+		} else {
+			result, err = t.manager.ExecuteUpdate(ctx, databaseName, query, args...)
+		}
+		if err != nil {
+			return nil, writeError(err)
+		}
+		rows, _ := result.RowsAffected()
+		return map[string]interface{}{"rows_affected": rows}, nil
+	}
 
-	// Get columns
-	columns, err := rows.Columns()
+	limits := t.manager.ResultLimits(databaseName, db.Limits{})
+	var rows []map[string]interface{}
+	var affected int64
+	var truncation db.Truncation
+	var err error
+	if tx != nil {
+		rows, affected, truncation, err = db.QueryReturning(ctx, tx, limits, query, args...)
+	} else {
+		rows, affected, truncation, err = t.manager.ExecuteReturning(ctx, databaseName, limits, query, args...)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("db_error: %w", err)
+		return nil, writeError(err)
+	}
+	response := map[string]interface{}{
+		"rows_affected": affected,
+		"rows":          rows,
+	}
+	if truncation.Truncated {
+		response["truncated"] = true
+		response["limit"] = truncation.Limit
+		response["total_rows"] = *truncation.TotalRows
+	}
+	if truncation.CellsTruncated > 0 {
+		response["cells_truncated"] = truncation.CellsTruncated
 	}
+	return response, nil
+}
 
-	// Prepare result
-	var result []map[string]interface{}
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
+// previewRecords reports what a record statement would change without
+// changing anything, inside tx when it is not nil
+func (t *DBTools) previewRecords(ctx context.Context, databaseName string, tx *db.Transaction, table *db.Table, statement db.Statement) (map[string]interface{}, error) {
+	limits := t.manager.ResultLimits(databaseName, db.Limits{})
+	var preview *db.Preview
+	var err error
+	if tx != nil {
+		preview, err = table.Preview(ctx, tx, limits, statement)
+	} else {
+		preview, err = t.manager.Preview(ctx, databaseName, table, limits, statement)
+	}
+	if err != nil {
+		return nil, writeError(err)
+	}
+	return previewResponse(preview), nil
+}
 
-	for i := range columns {
-		valuePtrs[i] = &values[i]
+// previewResponse describes a preview in the fields shared by the write tools
+func previewResponse(preview *db.Preview) map[string]interface{} {
+	response := map[string]interface{}{
+		"dry_run":       true,
+		"rows_affected": preview.RowsAffected,
+		"changes":       preview.Changes,
 	}
+	if preview.Truncated {
+		response["truncated"] = true
+		response["limit"] = preview.Limit
+		response["total_rows"] = *preview.TotalRows
+	}
+	return response
+}
 
-	for rows.Next() {
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("db_error: %w", err)
-		}
+// writeError classifies an error of a statement that modifies a database
+func writeError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrReadOnly):
+		return fmt.Errorf("readonly_error: %w", err)
+	case errors.Is(err, db.ErrTransactionActive):
+		return fmt.Errorf("transaction_active: %w", err)
+	}
+	return fmt.Errorf("db_error: %w", err)
+}
+
+// BatchRequest holds the parameters of db/batch
+type BatchRequest struct {
+	Operations []db.BatchOperation `json:"operations" description:"Statements to run"`
+	Mode       string              `json:"mode,omitempty" enum:"parallel,sequential,atomic" description:"Run operations concurrently in separate transactions (parallel, the default), in order in separate transactions (sequential), or in order in one transaction on a single database that is rolled back if any fails (atomic)"`
+	DryRun     bool                `json:"dry_run,omitempty" description:"Run the operations and report their results, then roll back all of their changes"`
+}
 
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			row[col] = values[i]
+// BatchResponse describes the result of db/batch
+type BatchResponse struct {
+	Results []db.BatchResult `json:"results" description:"Outcome of every operation, in request order"`
+	DryRun  bool             `json:"dry_run,omitempty" description:"All changes were rolled back"`
+}
+
+// Batch runs several statements and reports the outcome of each. Outside of
+// atomic mode a failed operation does not stop the others.
+func (t *DBTools) Batch(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req BatchRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+	if len(req.Operations) == 0 {
+		return nil, fmt.Errorf("invalid_params: no operations")
+	}
+
+	results, err := t.manager.ExecuteBatchMode(ctx, req.Mode, req.Operations, req.DryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrInvalidOperation):
+			return nil, fmt.Errorf("invalid_params: %w", err)
+		case errors.Is(err, db.ErrTransactionActive):
+			return nil, fmt.Errorf("transaction_active: %w", err)
 		}
-		result = append(result, row)
+		return nil, fmt.Errorf("database_connection_error: %w", err)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("db_error: %w", err)
+	response := map[string]interface{}{
+		"results": results,
 	}
+	if req.DryRun {
+		response["dry_run"] = true
+	}
+	return response, nil
+}
 
-	return map[string]interface{}{
-		"columns": columns,
-		"rows":    result,
-	}, nil
+// BulkInsertRequest holds the parameters of db/bulk_insert
+type BulkInsertRequest struct {
+	DatabaseName string          `json:"database_name" description:"Name of the registered database"`
+	TableName    string          `json:"table_name" description:"Target table"`
+	Columns      []string        `json:"columns" description:"Columns the values of each row are given for"`
+	Rows         [][]interface{} `json:"rows" description:"Rows to insert, each an array of values in column order"`
+	OnConflict   *db.Conflict    `json:"on_conflict,omitempty" description:"What to do with rows that violate a primary key or unique constraint; such rows fail the insert by default"`
+	DryRun       bool            `json:"dry_run,omitempty" description:"Report the changes without making them"`
 }
 
-// Helper functions
+// BulkInsertResponse describes the result of db/bulk_insert
+type BulkInsertResponse struct {
+	RowsAffected int64          `json:"rows_affected"`
+	DryRun       bool           `json:"dry_run,omitempty" description:"Nothing was changed; changes shows what the call would do"`
+	Changes      []db.RowChange `json:"changes,omitempty" description:"Rows the call would change, for a dry run"`
+	Truncated    bool           `json:"truncated,omitempty" description:"Whether changes holds only part of the affected rows"`
+	Limit        string         `json:"limit,omitempty" enum:"max_rows,max_bytes" description:"Limit that cut changes short"`
+	TotalRows    *int           `json:"total_rows,omitempty" description:"Number of affected rows when changes was truncated"`
+}
+
+// BulkInsert inserts many rows into a table in a single transaction
+func (t *DBTools) BulkInsert(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req BulkInsertRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
 
-func (t *DBTools) getTableColumns(database *sql.DB, tableName string) ([]map[string]interface{}, error) {
-	rows, err := database.Query(fmt.Sprintf("PRAGMA table_info('%s')", tableName))
+	operation := db.BulkInsertOperation{
+		Database:   req.DatabaseName,
+		Table:      req.TableName,
+		Columns:    req.Columns,
+		Values:     req.Rows,
+		OnConflict: req.OnConflict,
+	}
+	var rows int64
+	var preview *db.Preview
+	var err error
+	if req.DryRun {
+		preview, err = t.manager.PreviewBulkInsert(ctx, operation, t.manager.ResultLimits(req.DatabaseName, db.Limits{}))
+	} else {
+		rows, err = t.manager.BulkInsert(ctx, operation)
+	}
 	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrReadOnly):
+			return nil, fmt.Errorf("readonly_error: %w", err)
+		case errors.Is(err, db.ErrTransactionActive):
+			return nil, fmt.Errorf("transaction_active: %w", err)
+		case errors.Is(err, db.ErrTableNotFound):
+			return nil, fmt.Errorf("table_not_found: %w", err)
+		case errors.Is(err, db.ErrInvalidOperation):
+			return nil, fmt.Errorf("invalid_params: %w", err)
+		case errors.Is(ctx.Err(), context.Canceled):
+			return nil, fmt.Errorf("cancelled: %w", ctx.Err())
+		}
 		return nil, fmt.Errorf("db_error: %w", err)
 	}
+
+	if preview != nil {
+		return previewResponse(preview), nil
+	}
+	return map[string]interface{}{"rows_affected": rows}, nil
+}
+
+// ExecuteQueryRequest holds the parameters of db/query
+type ExecuteQueryRequest struct {
+	DatabaseName  string        `json:"database_name" description:"Name of the registered database"`
+	Query         string        `json:"query" description:"A single read-only SQL statement (SELECT, WITH, VALUES, EXPLAIN) with ? placeholders"`
+	Args          []interface{} `json:"args,omitempty" description:"Values bound to the query placeholders"`
+	TimeoutMS     int           `json:"timeout_ms,omitempty" description:"Abort the query after this many milliseconds instead of the server default"`
+	Stream        bool          `json:"stream,omitempty" description:"Deliver rows as notifications/result_chunk notifications instead of in the result; requires a progressToken"`
+	ChunkSize     int           `json:"chunk_size,omitempty" description:"Rows per streamed chunk"`
+	PageSize      int           `json:"page_size,omitempty" description:"Return at most this many rows and a nextCursor for the rest; use ORDER BY for a stable order"`
+	Cursor        string        `json:"cursor,omitempty" description:"nextCursor from a previous page of the same query"`
+	MaxRows       int           `json:"max_rows,omitempty" description:"Return at most this many rows; capped by the server's ceiling"`
+	MaxBytes      int           `json:"max_bytes,omitempty" description:"Return at most this many bytes of rows; capped by the server's ceiling"`
+	MaxCellBytes  int           `json:"max_cell_bytes,omitempty" description:"Shorten TEXT and BLOB values longer than this many bytes; capped by the server's ceiling"`
+	Format        string        `json:"format,omitempty" enum:"json,table,markdown,csv,ndjson" description:"Rows as objects (json, the default), as arrays in column order with typed columns (table), or rendered as markdown, csv or ndjson text"`
+	TransactionID string        `json:"transaction_id,omitempty" description:"Run inside this transaction from db/begin_transaction, seeing its uncommitted changes"`
+}
+
+// queryCursor is the server-side state of a paginated db/query
+type queryCursor struct {
+	database string
+	query    string
+	args     []interface{}
+	pageSize int
+	offset   int
+}
+
+// QueryResponse describes the result of db/query. Fields are set depending
+// on the format and on whether the result was streamed, paged or truncated.
+type QueryResponse struct {
+	Columns        []interface{} `json:"columns" description:"Column names, or {name, decltype} objects in the table format"`
+	Rows           []interface{} `json:"rows,omitempty" description:"Rows as objects, or as arrays in the table format; absent when streamed or rendered as text"`
+	Text           string        `json:"text,omitempty" description:"Rows rendered in a text format"`
+	MimeType       string        `json:"mime_type,omitempty" description:"MIME type of text"`
+	RowCount       int           `json:"row_count,omitempty" description:"Number of rows streamed or rendered as text"`
+	Chunks         int           `json:"chunks,omitempty" description:"Number of chunks streamed"`
+	Streamed       bool          `json:"streamed,omitempty" description:"The rows were delivered as notifications/result_chunk"`
+	Truncated      bool          `json:"truncated,omitempty" description:"The result was cut to fit its limits"`
+	Limit          string        `json:"limit,omitempty" enum:"max_rows,max_bytes" description:"The limit that cut the result"`
+	Limits         *db.Limits    `json:"limits,omitempty" description:"Limits applied to a truncated result"`
+	TotalRows      int           `json:"total_rows,omitempty" description:"Total rows of a truncated result, when cheap to count"`
+	CellsTruncated int           `json:"cells_truncated,omitempty" description:"Number of values shortened to max_cell_bytes"`
+	NextCursor     string        `json:"nextCursor,omitempty" description:"Cursor of the next page"`
+}
+
+// FormattedResult is a db/query result rendered as text. Metadata holds the
+// rest of the response, such as the columns and nextCursor.
+type FormattedResult struct {
+	MimeType string                 `json:"mimeType"`
+	Text     string                 `json:"text"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// QueryChunk is a block of rows delivered while a streamed db/query runs
+type QueryChunk struct {
+	Columns interface{} `json:"columns"`
+	Offset  int         `json:"offset"`
+	Rows    interface{} `json:"rows"`
+}
+
+// ExecuteQuery executes a read-only SQL query
+func (t *DBTools) ExecuteQuery(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req ExecuteQueryRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	// Get database connection, or the transaction to read through
+	var database db.Queryer
+	tx, err := t.useTransaction(ctx, req.DatabaseName, req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		defer tx.Done()
+		database = tx
+	} else if database, err = t.manager.GetConnection(req.DatabaseName); err != nil {
+		return nil, fmt.Errorf("database_connection_error: %w", err)
+	}
+
+	tracker := progress.FromContext(ctx)
+	if req.Stream && !tracker.Streaming() {
+		return nil, fmt.Errorf("invalid_params: stream requires a progressToken on a transport that can deliver notifications with the response")
+	}
+
+	// Resume a paginated query from its cursor
+	pageSize, offset := req.PageSize, 0
+	if req.Cursor != "" {
+		state, err := t.cursors.Get(req.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid_cursor: %w", err)
+		}
+		qc := state.(*queryCursor)
+		if qc.database != req.DatabaseName || qc.query != req.Query {
+			return nil, fmt.Errorf("invalid_cursor: cursor belongs to a different query")
+		}
+		req.Args, offset = qc.args, qc.offset
+		if pageSize <= 0 {
+			pageSize = qc.pageSize
+		}
+	}
+
+	format, err := db.ParseFormat(req.Format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	paged := pageSize > 0
+	if paged && req.Stream {
+		return nil, fmt.Errorf("invalid_params: stream and page_size cannot be combined")
+	}
+	if req.Stream && db.IsTextFormat(format) {
+		return nil, fmt.Errorf("invalid_params: stream supports the json and table formats only")
+	}
+
+	// Bound the result. Pages never exceed the row limit and streamed
+	// results, which are not held in memory, only have their cells shortened.
+	limits := t.manager.ResultLimits(req.DatabaseName, db.Limits{
+		MaxRows:      req.MaxRows,
+		MaxBytes:     req.MaxBytes,
+		MaxCellBytes: req.MaxCellBytes,
+	})
+	if paged && limits.MaxRows > 0 && pageSize > limits.MaxRows {
+		pageSize = limits.MaxRows
+	}
+	guardLimits := limits
+	if req.Stream {
+		guardLimits = db.Limits{MaxCellBytes: limits.MaxCellBytes}
+	}
+
+	// Verify the query is a single read-only statement
+	var statement string
+	if tx != nil {
+		statement, err = tx.VerifyReadOnly(ctx, req.Query)
+	} else {
+		statement, err = t.manager.VerifyReadOnly(ctx, req.DatabaseName, req.Query)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid_query: %w", err)
+	}
+
+	// Bound the query so SQLite interrupts it when the timeout expires
+	timeout := t.queryTimeout
+	if req.TimeoutMS > 0 {
+		timeout = time.Duration(req.TimeoutMS) * time.Millisecond
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Pages are selected in SQL when the statement allows it, otherwise
+	// the rows before the page are skipped while reading
+	skip := 0
+	if paged {
+		var wrapped bool
+		if statement, wrapped = db.PageQuery(statement, pageSize+1, offset); !wrapped {
+			skip = offset
+		}
+	}
+
+	// Execute query
+	rows, err := database.QueryContext(ctx, statement, req.Args...)
+	if err != nil {
+		return nil, queryError(ctx, timeout, err)
+	}
 	defer rows.Close()
 
-	var columns []map[string]interface{}
-	for rows.Next() {
-		var cid int
-		var name, typ string
-		var notnull, pk int
-		var dfltValue interface{}
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, queryError(ctx, timeout, err)
+	}
+	var columns interface{} = names
+	if format == db.FormatTable {
+		if columns, err = db.ResultColumns(rows); err != nil {
+			return nil, queryError(ctx, timeout, err)
+		}
+	}
 
-		if err := rows.Scan(&cid, &name, &typ, &notnull, &dfltValue, &pk); err != nil {
-			return nil, fmt.Errorf("db_error: %w", err)
+	chunkSize := req.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	guard := db.NewRowGuard(guardLimits, format, names)
+
+	// Rows are collected for the result, or sent in chunks and dropped when streamed
+	result := db.NewRowSet(format, names)
+	count, chunks := 0, 0
+	more := false
+	flush := func() error {
+		if result.Len() == 0 {
+			return nil
+		}
+		err := tracker.Send(QueryChunk{Columns: columns, Offset: count - result.Len(), Rows: result.Rows()})
+		result.Reset()
+		chunks++
+		return err
+	}
+
+	err = db.EachRowValues(rows, func(values []interface{}) error {
+		if skip > 0 {
+			skip--
+			return nil
+		}
+		if paged && count == pageSize {
+			more = true
+			return errPageFull
+		}
+		if !guard.Admit(values) {
+			more = true
+			return errPageFull
+		}
+
+		count++
+		result.Add(values)
+		if req.Stream && result.Len() >= chunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
 		}
 
-		columns = append(columns, map[string]interface{}{
-			"name":        name,
-			"type":        typ,
-			"nullable":    notnull == 0,
-			"default":     dfltValue,
-			"primary_key": pk == 1,
+		if count%progressInterval == 0 {
+			tracker.Report(float64(count), 0, fmt.Sprintf("%d rows read", count))
+		}
+		return nil
+	})
+	if err == nil && req.Stream {
+		err = flush()
+	}
+	if err != nil && err != errPageFull {
+		return nil, queryError(ctx, timeout, err)
+	}
+	if guard.Truncated && !paged {
+		guard.CountTotal(rows)
+	}
+
+	if req.Stream {
+		response := map[string]interface{}{
+			"columns":   columns,
+			"row_count": count,
+			"chunks":    chunks,
+			"streamed":  true,
+		}
+		if guard.CellsTruncated > 0 {
+			response["cells_truncated"] = guard.CellsTruncated
+		}
+		return response, nil
+	}
+
+	response := map[string]interface{}{
+		"columns": columns,
+		"rows":    result.Rows(),
+	}
+	if guard.CellsTruncated > 0 {
+		response["cells_truncated"] = guard.CellsTruncated
+	}
+
+	// A page cut short by the byte limit simply ends early, while a result
+	// cut by any limit is reported as truncated and can be resumed as pages
+	if guard.Truncated && !paged {
+		response["truncated"] = true
+		response["limit"] = guard.Limit
+		response["limits"] = limits
+		if guard.TotalRows != nil {
+			response["total_rows"] = *guard.TotalRows
+		}
+		pageSize = limits.MaxRows
+		if pageSize <= 0 {
+			pageSize = count
+		}
+	}
+	if more {
+		response["nextCursor"] = t.cursors.Put(&queryCursor{
+			database: req.DatabaseName,
+			query:    req.Query,
+			args:     req.Args,
+			pageSize: pageSize,
+			offset:   offset + count,
 		})
 	}
 
-	return columns, rows.Err()
+	if db.IsTextFormat(format) {
+		delete(response, "rows")
+		response["row_count"] = count
+		return &FormattedResult{
+			MimeType: db.FormatMimeType(format),
+			Text:     result.Text(),
+			Metadata: response,
+		}, nil
+	}
+	return response, nil
+}
+
+// Helper functions
+
+// queryError reports an interrupted query as a timeout or cancellation rather than a database error
+func queryError(ctx context.Context, timeout time.Duration, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("timeout_error: query exceeded %s: %w", timeout, ctx.Err())
+	case context.Canceled:
+		return fmt.Errorf("cancelled: %w", ctx.Err())
+	}
+	return fmt.Errorf("db_error: %w", err)
 }
 
-func (t *DBTools) getTableIndexes(database *sql.DB, tableName string) ([]map[string]interface{}, error) {
-	rows, err := database.Query(`
+func (t *DBTools) getTableColumns(ctx context.Context, database *sql.DB, tableName string) ([]map[string]interface{}, error) {
+	tableColumns, err := db.TableColumns(ctx, database, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("db_error: %w", err)
+	}
+
+	columns := make([]map[string]interface{}, len(tableColumns))
+	for i, col := range tableColumns {
+		columns[i] = map[string]interface{}{
+			"name":        col.Name,
+			"type":        col.Type,
+			"nullable":    !col.NotNull,
+			"default":     col.Default,
+			"primary_key": col.PrimaryKey > 0,
+		}
+	}
+
+	return columns, nil
+}
+
+func (t *DBTools) getTableIndexes(ctx context.Context, database *sql.DB, tableName string) ([]map[string]interface{}, error) {
+	rows, err := database.QueryContext(ctx, `
 		SELECT name, sql
 		FROM sqlite_master
-		WHERE type='index' AND tbl_name=?
+		WHERE type='index' AND tbl_name=? AND sql IS NOT NULL
 	`, tableName)
 	if err != nil {
 		return nil, fmt.Errorf("db_error: %w", err)
 	}
 	defer rows.Close()
 
-	var indexes []map[string]interface{}
+	indexes := []map[string]interface{}{}
 	for rows.Next() {
 		var name, sql string
 		if err := rows.Scan(&name, &sql); err != nil {
@@ -297,8 +1052,3 @@ func (t *DBTools) getTableIndexes(database *sql.DB, tableName string) ([]map[str
 
 	return indexes, rows.Err()
 }
-
-func isReadOnlyQuery(query string) bool {
-	query = strings.TrimSpace(strings.ToUpper(query))
-	return strings.HasPrefix(query, "SELECT") || strings.HasPrefix(query, "EXPLAIN")
-}
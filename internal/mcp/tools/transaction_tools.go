@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nipunap/sqlite-mcp-server/internal/db"
+)
+
+// BeginTransactionRequest holds the parameters of db/begin_transaction
+type BeginTransactionRequest struct {
+	DatabaseName string `json:"database_name" description:"Name of the registered database"`
+}
+
+// TransactionRequest holds the parameters of db/commit
+type TransactionRequest struct {
+	TransactionID string `json:"transaction_id" description:"Handle returned by db/begin_transaction"`
+}
+
+// RollbackRequest holds the parameters of db/rollback
+type RollbackRequest struct {
+	TransactionID string `json:"transaction_id" description:"Handle returned by db/begin_transaction"`
+	Savepoint     string `json:"savepoint,omitempty" description:"Only undo the changes made since this savepoint and keep the transaction open"`
+}
+
+// SavepointRequest holds the parameters of db/savepoint and db/release_savepoint
+type SavepointRequest struct {
+	TransactionID string `json:"transaction_id" description:"Handle returned by db/begin_transaction"`
+	Name          string `json:"name" description:"Name of the savepoint"`
+}
+
+// TransactionResponse describes the state of a transaction after a transaction tool
+type TransactionResponse struct {
+	TransactionID string   `json:"transaction_id"`
+	DatabaseName  string   `json:"database_name"`
+	Status        string   `json:"status" enum:"open,committed,rolled_back"`
+	Savepoints    []string `json:"savepoints,omitempty" description:"Savepoints held, outermost first"`
+	IdleTimeoutMS int64    `json:"idle_timeout_ms,omitempty" description:"The transaction is rolled back when unused for this long"`
+}
+
+// BeginTransaction opens a transaction whose handle later calls pass as transaction_id
+func (t *DBTools) BeginTransaction(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req BeginTransactionRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	tx, err := t.manager.BeginTransaction(ctx, req.DatabaseName)
+	if err != nil {
+		if errors.Is(err, db.ErrTransactionActive) {
+			return nil, fmt.Errorf("transaction_active: %w", err)
+		}
+		return nil, fmt.Errorf("database_connection_error: %w", err)
+	}
+
+	return transactionStatus(tx, "open"), nil
+}
+
+// Commit commits a transaction
+func (t *DBTools) Commit(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req TransactionRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	tx, err := t.useTransaction(ctx, "", req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Done()
+
+	if err := tx.Commit(); err != nil {
+		return nil, transactionError(err)
+	}
+	return transactionStatus(tx, "committed"), nil
+}
+
+// Rollback rolls back a transaction, or only to one of its savepoints
+func (t *DBTools) Rollback(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req RollbackRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	tx, err := t.useTransaction(ctx, "", req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Done()
+
+	if req.Savepoint != "" {
+		if err := tx.RollbackToSavepoint(ctx, req.Savepoint); err != nil {
+			return nil, transactionError(err)
+		}
+		return transactionStatus(tx, "open"), nil
+	}
+	if err := tx.Rollback(); err != nil {
+		return nil, transactionError(err)
+	}
+	return transactionStatus(tx, "rolled_back"), nil
+}
+
+// Savepoint starts a savepoint inside a transaction
+func (t *DBTools) Savepoint(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req SavepointRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	tx, err := t.useTransaction(ctx, "", req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Done()
+
+	if err := tx.Savepoint(ctx, req.Name); err != nil {
+		return nil, transactionError(err)
+	}
+	return transactionStatus(tx, "open"), nil
+}
+
+// ReleaseSavepoint keeps the changes made since a savepoint and forgets it
+func (t *DBTools) ReleaseSavepoint(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var req SavepointRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, fmt.Errorf("invalid_params: %w", err)
+	}
+
+	tx, err := t.useTransaction(ctx, "", req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Done()
+
+	if err := tx.ReleaseSavepoint(ctx, req.Name); err != nil {
+		return nil, transactionError(err)
+	}
+	return transactionStatus(tx, "open"), nil
+}
+
+// useTransaction picks up the transaction with the given handle for the
+// duration of a call, which must hand it back with Done. It returns nil when
+// id is empty. A non-empty databaseName must match the transaction's database.
+func (t *DBTools) useTransaction(ctx context.Context, databaseName, id string) (*db.Transaction, error) {
+	if id == "" {
+		return nil, nil
+	}
+	tx, err := t.manager.UseTransaction(ctx, id)
+	if err != nil {
+		return nil, transactionError(err)
+	}
+	if databaseName != "" && tx.Database() != databaseName {
+		tx.Done()
+		return nil, fmt.Errorf("invalid_params: transaction %s belongs to database %s", id, tx.Database())
+	}
+	return tx, nil
+}
+
+// transactionError classifies an error of a transaction tool
+func transactionError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrTransactionNotFound):
+		return fmt.Errorf("transaction_not_found: %w", err)
+	case errors.Is(err, db.ErrSavepointNotFound):
+		return fmt.Errorf("invalid_params: %w", err)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("cancelled: %w", err)
+	}
+	return fmt.Errorf("db_error: %w", err)
+}
+
+func transactionStatus(tx *db.Transaction, status string) map[string]interface{} {
+	response := map[string]interface{}{
+		"transaction_id": tx.ID(),
+		"database_name":  tx.Database(),
+		"status":         status,
+	}
+	if status != "open" {
+		return response
+	}
+	if savepoints := tx.Savepoints(); len(savepoints) > 0 {
+		response["savepoints"] = savepoints
+	}
+	if idle := tx.IdleTimeout(); idle > 0 {
+		response["idle_timeout_ms"] = idle.Milliseconds()
+	}
+	return response
+}
@@ -4,9 +4,13 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 // JSONRPCMessage represents a JSON-RPC 2.0 message
@@ -26,45 +30,113 @@ type JSONRPCError struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-// STDIOTransport handles STDIO-based JSON-RPC communication
-type STDIOTransport struct {
-	reader *bufio.Reader
-	writer *bufio.Writer
+// Standard JSON-RPC 2.0 error codes, plus the server-defined range used by MCP
+const (
+	ErrCodeParseError     = -32700
+	ErrCodeInvalidRequest = -32600
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeInternalError  = -32603
+	ErrCodeServerError    = -32000
+
+	// ErrCodeResourceNotFound is returned by resources/read for unknown URIs
+	ErrCodeResourceNotFound = -32002
+)
+
+// newResultResponse builds a successful response for the request with the given ID
+func newResultResponse(id *json.RawMessage, result interface{}) *JSONRPCMessage {
+	return &JSONRPCMessage{
+		Version: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+}
+
+// newErrorResponse builds an error response for the request with the given ID
+func newErrorResponse(id *json.RawMessage, code int, message string) *JSONRPCMessage {
+	return &JSONRPCMessage{
+		Version: "2.0",
+		ID:      id,
+		Error: &JSONRPCError{
+			Code:    code,
+			Message: message,
+		},
+	}
+}
+
+// ErrInvalidMessage is returned by ReadMessage when a line is not valid JSON-RPC
+var ErrInvalidMessage = errors.New("invalid message")
+
+// SessionHandler dispatches a message received on a client session and returns the response, if any
+type SessionHandler func(ctx context.Context, sess *Session, msg *JSONRPCMessage) *JSONRPCMessage
+
+// Transport carries JSON-RPC messages between clients and the server
+type Transport interface {
+	// Serve delivers incoming messages to handler until ctx is canceled or the
+	// transport has no more clients to serve
+	Serve(ctx context.Context, handler SessionHandler) error
+}
+
+// StreamTransport exchanges newline-delimited JSON-RPC messages over a single
+// byte stream such as STDIO, a pipe or one socket connection. The whole
+// stream is a single session.
+type StreamTransport struct {
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	closer  io.Closer
+	writeMu sync.Mutex
 }
 
 // NewSTDIOTransport creates a new STDIO transport
-func NewSTDIOTransport() *STDIOTransport {
-	return &STDIOTransport{
+func NewSTDIOTransport() *StreamTransport {
+	return &StreamTransport{
 		reader: bufio.NewReader(os.Stdin),
 		writer: bufio.NewWriter(os.Stdout),
 	}
 }
 
-// ReadMessage reads a JSON-RPC message from STDIN
-func (t *STDIOTransport) ReadMessage() (*JSONRPCMessage, error) {
-	line, err := t.reader.ReadString('\n')
-	if err != nil {
-		if err == io.EOF {
-			return nil, err
-		}
-		return nil, fmt.Errorf("failed to read message: %v", err)
+// NewStreamTransport creates a transport over rwc, which is closed when serving ends
+func NewStreamTransport(rwc io.ReadWriteCloser) *StreamTransport {
+	return &StreamTransport{
+		reader: bufio.NewReader(rwc),
+		writer: bufio.NewWriter(rwc),
+		closer: rwc,
 	}
+}
 
-	var msg JSONRPCMessage
-	if err := json.Unmarshal([]byte(line), &msg); err != nil {
-		return nil, fmt.Errorf("failed to parse message: %v", err)
-	}
+// ReadMessage reads the next JSON-RPC message from the stream
+func (t *StreamTransport) ReadMessage() (*JSONRPCMessage, error) {
+	for {
+		line, err := t.reader.ReadString('\n')
+		if strings.TrimSpace(line) == "" {
+			if err != nil {
+				if err == io.EOF {
+					return nil, err
+				}
+				return nil, fmt.Errorf("failed to read message: %v", err)
+			}
+			continue
+		}
+
+		var msg JSONRPCMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
 
-	return &msg, nil
+		return &msg, nil
+	}
 }
 
-// WriteMessage writes a JSON-RPC message to STDOUT
-func (t *STDIOTransport) WriteMessage(msg *JSONRPCMessage) error {
+// WriteMessage writes a JSON-RPC message to the stream
+func (t *StreamTransport) WriteMessage(msg *JSONRPCMessage) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %v", err)
 	}
 
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
 	if _, err := t.writer.Write(data); err != nil {
 		return fmt.Errorf("failed to write message: %v", err)
 	}
@@ -76,27 +148,72 @@ func (t *STDIOTransport) WriteMessage(msg *JSONRPCMessage) error {
 	return t.writer.Flush()
 }
 
-// HandleMessages processes incoming messages until context is canceled
-func (t *STDIOTransport) HandleMessages(ctx context.Context, handler func(*JSONRPCMessage) *JSONRPCMessage) error {
+// Serve processes incoming messages on a single session until the stream ends
+// or ctx is canceled. Requests are dispatched concurrently and their responses
+// written as they complete; on cancellation the transport stops reading and
+// waits for in-flight requests to be answered before returning.
+func (t *StreamTransport) Serve(ctx context.Context, handler SessionHandler) error {
+	sess := NewSession()
+	sess.setNotifier(t.WriteMessage)
+	defer sess.setNotifier(nil)
+
+	if t.closer != nil {
+		defer t.closer.Close()
+	}
+
+	d := newDispatcher(ctx, sess, handler, t.WriteMessage)
+
+	type readResult struct {
+		msg *JSONRPCMessage
+		err error
+	}
+	messages := make(chan readResult)
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go func() {
+		for {
+			msg, err := t.ReadMessage()
+			select {
+			case messages <- readResult{msg, err}:
+			case <-stopped:
+				return
+			}
+			if err != nil && !errors.Is(err, ErrInvalidMessage) {
+				return
+			}
+		}
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			msg, err := t.ReadMessage()
-			if err == io.EOF {
-				return nil
-			}
-			if err != nil {
+			t.stopReading()
+			if err := d.wait(); err != nil {
 				return err
 			}
-
-			response := handler(msg)
-			if response != nil {
-				if err := t.WriteMessage(response); err != nil {
-					return err
-				}
+			return ctx.Err()
+		case r := <-messages:
+			switch {
+			case r.err == nil:
+				d.dispatch(r.msg)
+			case errors.Is(r.err, ErrInvalidMessage):
+				d.send(newErrorResponse(nil, ErrCodeParseError, "Parse error"))
+			case r.err == io.EOF:
+				return d.wait()
+			default:
+				d.wait()
+				return r.err
 			}
 		}
 	}
 }
+
+// stopReading unblocks a pending read without closing the write side, so
+// in-flight responses can still be delivered. Streams without read deadlines
+// are unblocked when they are closed after draining.
+func (t *StreamTransport) stopReading() {
+	if conn, ok := t.closer.(interface{ SetReadDeadline(time.Time) error }); ok {
+		conn.SetReadDeadline(time.Now())
+	}
+}
@@ -0,0 +1,505 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// exchange writes a request line and reads the response line from a client connection
+func exchange(t *testing.T, conn io.Writer, reader *bufio.Reader, request string) JSONRPCMessage {
+	t.Helper()
+
+	if _, err := fmt.Fprintln(conn, request); err != nil {
+		t.Fatalf("Failed to write request: %v", err)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	var msg JSONRPCMessage
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", line, err)
+	}
+	return msg
+}
+
+const initializeRequest = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`
+
+func TestStreamTransport(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, NewStreamTransport(serverConn))
+	}()
+
+	reader := bufio.NewReader(clientConn)
+
+	if msg := exchange(t, clientConn, reader, initializeRequest); msg.Error != nil {
+		t.Fatalf("Initialize failed: %v", msg.Error)
+	}
+
+	// Malformed lines get a parse error instead of killing the session
+	if msg := exchange(t, clientConn, reader, `{not json`); msg.Error == nil || msg.Error.Code != ErrCodeParseError {
+		t.Errorf("Expected parse error, got %+v", msg)
+	}
+
+	if msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); msg.Error != nil {
+		t.Errorf("tools/list failed: %v", msg.Error)
+	}
+
+	// Canceling the context stops the transport even while it waits for input
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Transport did not stop after cancellation")
+	}
+}
+
+func TestUnixSocketTransport(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "mcp.sock")
+	transport, err := ParseListenAddress("unix:" + socketPath)
+	if err != nil {
+		t.Fatalf("Failed to parse listen address: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, transport)
+	}()
+
+	// Each connection is an independent session
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("unix", transport.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		reader := bufio.NewReader(conn)
+
+		if msg := exchange(t, conn, reader, initializeRequest); msg.Error != nil {
+			t.Errorf("Connection %d: initialize failed: %v", i, msg.Error)
+		}
+		conn.Close()
+	}
+
+	// An open connection does not prevent shutdown
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Transport did not stop after cancellation")
+	}
+}
+
+func TestListenerTransportListenFailure(t *testing.T) {
+	t.Parallel()
+
+	transport := NewUnixTransport(filepath.Join(t.TempDir(), "missing", "mcp.sock"))
+	if err := transport.Serve(context.Background(), nil); err == nil {
+		t.Fatal("Expected Serve to fail to listen")
+	}
+
+	addr := make(chan net.Addr, 1)
+	go func() { addr <- transport.Addr() }()
+	select {
+	case a := <-addr:
+		if a != nil {
+			t.Errorf("Expected nil address, got %v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Addr blocked after a failed listen")
+	}
+}
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		spec    string
+		network string
+		address string
+	}{
+		{"unix:/tmp/mcp.sock", "unix", "/tmp/mcp.sock"},
+		{"unix:///tmp/mcp.sock", "unix", "/tmp/mcp.sock"},
+		{"/tmp/mcp.sock", "unix", "/tmp/mcp.sock"},
+		{"tcp:127.0.0.1:7000", "tcp", "127.0.0.1:7000"},
+		{"tcp://localhost:7000", "tcp", "localhost:7000"},
+	}
+	for _, tt := range tests {
+		transport, err := ParseListenAddress(tt.spec)
+		if err != nil {
+			t.Errorf("ParseListenAddress(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if transport.network != tt.network || transport.address != tt.address {
+			t.Errorf("ParseListenAddress(%q) = %s %s, want %s %s", tt.spec, transport.network, transport.address, tt.network, tt.address)
+		}
+	}
+
+	if _, err := ParseListenAddress("localhost:7000"); err == nil {
+		t.Error("Expected error for address without scheme")
+	}
+}
+
+func TestStreamTransportConcurrency(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+
+	// "slow" requests and steps a1 and c1 block until released, everything else answers immediately
+	handler := func(ctx context.Context, sess *Session, msg *JSONRPCMessage) *JSONRPCMessage {
+		if msg.ID == nil {
+			return nil
+		}
+		var params struct {
+			Arguments struct {
+				Step string `json:"step"`
+			} `json:"arguments"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		if msg.Method == "slow" || params.Arguments.Step == "a1" || params.Arguments.Step == "c1" {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, params.Arguments.Step)
+		mu.Unlock()
+		return newResultResponse(msg.ID, msg.Method)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewStreamTransport(serverConn).Serve(ctx, handler)
+	}()
+	reader := bufio.NewReader(clientConn)
+
+	// A fast request is answered while a slow one is still running
+	fmt.Fprintln(clientConn, `{"jsonrpc":"2.0","id":1,"method":"slow"}`)
+	if msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":2,"method":"fast"}`); string(*msg.ID) != "2" {
+		t.Fatalf("Expected response to request 2 first, got %s", *msg.ID)
+	}
+
+	// Duplicate IDs of in-flight requests are refused
+	if msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":1,"method":"fast"}`); msg.Error == nil || msg.Error.Code != ErrCodeInvalidRequest {
+		t.Errorf("Expected duplicate ID error, got %+v", msg)
+	}
+
+	// Requests on the same database wait for an earlier write, in order
+	fmt.Fprintln(clientConn, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"db/insert_record","arguments":{"database_name":"a","step":"a1"}}}`)
+	fmt.Fprintln(clientConn, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"a","step":"a2"}}}`)
+	if msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"b","step":"b1"}}}`); string(*msg.ID) != "5" {
+		t.Fatalf("Expected response to request 5 first, got %s", *msg.ID)
+	}
+
+	// Reads of the same database do not wait for each other
+	fmt.Fprintln(clientConn, `{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"c","step":"c1"}}}`)
+	if msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"c","step":"c2"}}}`); string(*msg.ID) != "7" {
+		t.Fatalf("Expected response to request 7 first, got %s", *msg.ID)
+	}
+
+	// Canceling drains in-flight requests before the transport returns
+	cancel()
+	select {
+	case err := <-done:
+		t.Fatalf("Transport returned before draining: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	ids := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read drained response: %v", err)
+		}
+		var msg JSONRPCMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("Failed to parse response %q: %v", line, err)
+		}
+		ids[string(*msg.ID)] = true
+	}
+	for _, id := range []string{"1", "3", "4", "6"} {
+		if !ids[id] {
+			t.Errorf("Missing drained response to request %s", id)
+		}
+	}
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Transport did not stop after draining")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var a1, a2 = -1, -1
+	for i, step := range order {
+		switch step {
+		case "a1":
+			a1 = i
+		case "a2":
+			a2 = i
+		}
+	}
+	if a1 < 0 || a2 < 0 || a1 > a2 {
+		t.Errorf("Expected a1 before a2, got order %v", order)
+	}
+}
+
+func TestOrderingKey(t *testing.T) {
+	tests := []struct {
+		message string
+		keys    []string
+		write   bool
+	}{
+		{`{"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"main"}}}`, []string{"main"}, false},
+		{`{"method":"tools/call","params":{"name":"db/insert_record","arguments":{"database_name":"main"}}}`, []string{"main"}, true},
+		{`{"method":"tools/call","params":{"name":"db/register_database","arguments":{"name":"new"}}}`, []string{"new"}, true},
+		{`{"method":"tools/call","params":{"name":"db/list_databases"}}`, nil, false},
+		{`{"method":"tools/call","params":{"name":"db/batch","arguments":{"operations":[{"database":"a","query":"SELECT 1"},{"database":"b","query":"DELETE FROM t"},{"database":"a","query":"SELECT 2"}]}}}`, []string{"a", "b"}, true},
+		{`{"method":"tools/call","params":{"name":"db/batch","arguments":{"operations":[{"database":"a","query":"SELECT 1"},{"database":"b","query":"VALUES (1)"}]}}}`, []string{"a", "b"}, false},
+		{`{"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"main","transaction_id":"t1"}}}`, []string{"main", "transaction/t1"}, true},
+		{`{"method":"tools/call","params":{"name":"db/commit","arguments":{"transaction_id":"t1"}}}`, []string{"transaction/t1"}, true},
+		{`{"method":"invoke","params":{"name":"db/query","params":{"database_name":"main"}}}`, []string{"main"}, false},
+		{`{"method":"invoke","params":{"name":"db/batch","params":{"database_name":"main"}}}`, []string{"main"}, true},
+		{`{"method":"resources/read","params":{"uri":"sqlite://main/tables/users"}}`, []string{"main"}, false},
+		{`{"method":"resources/read","params":{"uri":"sqlite://databases"}}`, nil, false},
+		{`{"method":"tools/list"}`, nil, false},
+	}
+	for _, tt := range tests {
+		var msg JSONRPCMessage
+		if err := json.Unmarshal([]byte(tt.message), &msg); err != nil {
+			t.Fatalf("Failed to parse %s: %v", tt.message, err)
+		}
+		if keys, write := orderingKeys(&msg); !reflect.DeepEqual(keys, tt.keys) || write != tt.write {
+			t.Errorf("orderingKeys(%s) = %q, %v, want %q, %v", tt.message, keys, write, tt.keys, tt.write)
+		}
+	}
+}
+
+func TestPipelinedOrdering(t *testing.T) {
+	t.Parallel()
+
+	// Each case pipelines tool calls that must run in the order sent: the
+	// first blocks until released, and none of the others may overtake it
+	tests := []struct {
+		name  string
+		calls []string
+	}{
+		{"BatchThenQuery", []string{
+			`{"name":"db/batch","arguments":{"operations":[{"database":"a","query":"INSERT INTO t VALUES (1)"}]}}`,
+			`{"name":"db/query","arguments":{"database_name":"a"}}`,
+		}},
+		{"ReadingBatchThenInsert", []string{
+			`{"name":"db/batch","arguments":{"operations":[{"database":"b","query":"SELECT 1"},{"database":"a","query":"SELECT 1"}]}}`,
+			`{"name":"db/insert_record","arguments":{"database_name":"a"}}`,
+		}},
+		{"InsertThenCommit", []string{
+			`{"name":"db/insert_record","arguments":{"database_name":"a","transaction_id":"t1"}}`,
+			`{"name":"db/commit","arguments":{"transaction_id":"t1"}}`,
+		}},
+		{"CommitThenQuery", []string{
+			`{"name":"db/query","arguments":{"database_name":"a","transaction_id":"t1"}}`,
+			`{"name":"db/savepoint","arguments":{"transaction_id":"t1","name":"s"}}`,
+			`{"name":"db/commit","arguments":{"transaction_id":"t1"}}`,
+			`{"name":"db/query","arguments":{"database_name":"a"}}`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			var mu sync.Mutex
+			var order []string
+			handler := func(ctx context.Context, sess *Session, msg *JSONRPCMessage) *JSONRPCMessage {
+				if msg.ID == nil {
+					return nil
+				}
+				if string(*msg.ID) == "1" {
+					<-release
+				}
+				mu.Lock()
+				order = append(order, string(*msg.ID))
+				mu.Unlock()
+				return newResultResponse(msg.ID, msg.Method)
+			}
+
+			serverConn, clientConn := net.Pipe()
+			defer clientConn.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go NewStreamTransport(serverConn).Serve(ctx, handler)
+			reader := bufio.NewReader(clientConn)
+
+			barrier := strconv.Itoa(len(tt.calls) + 1)
+			want := []string{barrier}
+			for i, call := range tt.calls {
+				fmt.Fprintf(clientConn, `{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":%s}`+"\n", i+1, call)
+				want = append(want, strconv.Itoa(i+1))
+			}
+			if msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":`+barrier+`,"method":"fast"}`); string(*msg.ID) != barrier {
+				t.Fatalf("Expected response to request %s first, got %s", barrier, *msg.ID)
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			for range tt.calls {
+				if _, err := reader.ReadString('\n'); err != nil {
+					t.Fatalf("Failed to read response: %v", err)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(order, want) {
+				t.Errorf("Expected requests to run in order %v, got %v", want, order)
+			}
+		})
+	}
+}
+
+func TestCancelledRequest(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Serve(ctx, NewStreamTransport(serverConn))
+
+	reader := bufio.NewReader(clientConn)
+	if msg := exchange(t, clientConn, reader, initializeRequest); msg.Error != nil {
+		t.Fatalf("Initialize failed: %v", msg.Error)
+	}
+	fmt.Fprintln(clientConn, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	// Start a query that never finishes on its own, then cancel it
+	fmt.Fprintln(clientConn, `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"test","query":"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c"}}}`)
+	time.Sleep(50 * time.Millisecond)
+	fmt.Fprintln(clientConn, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7,"reason":"user abort"}}`)
+
+	// The database is usable again and the cancelled request gets no response
+	msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"test","query":"SELECT 1 AS one"}}}`)
+	if string(*msg.ID) != "8" {
+		t.Fatalf("Expected response to request 8, got %s", *msg.ID)
+	}
+	if result, ok := msg.Result.(map[string]interface{}); !ok || result["isError"] == true {
+		t.Errorf("Expected query to succeed after cancellation, got %+v", msg.Result)
+	}
+}
+
+func TestLogNotifications(t *testing.T) {
+	t.Parallel()
+
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	server, err := NewServer(manager)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Serve(ctx, NewStreamTransport(serverConn))
+
+	reader := bufio.NewReader(clientConn)
+	if msg := exchange(t, clientConn, reader, initializeRequest); msg.Error != nil {
+		t.Fatalf("Initialize failed: %v", msg.Error)
+	}
+	fmt.Fprintln(clientConn, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	failing := `{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"db/query","arguments":{"database_name":"test","query":"SELECT * FROM missing"}}}`
+
+	// Nothing is logged before the client sets a level
+	if msg := exchange(t, clientConn, reader, fmt.Sprintf(failing, 2)); msg.ID == nil || string(*msg.ID) != "2" {
+		t.Fatalf("Expected the response to request 2, got %+v", msg)
+	}
+
+	if msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":3,"method":"logging/setLevel","params":{"level":"error"}}`); msg.Error != nil {
+		t.Fatalf("logging/setLevel failed: %v", msg.Error)
+	}
+
+	// Successful requests are below the level, failures are reported ahead of their response
+	if msg := exchange(t, clientConn, reader, `{"jsonrpc":"2.0","id":4,"method":"tools/list"}`); msg.ID == nil || string(*msg.ID) != "4" {
+		t.Fatalf("Expected the response to request 4, got %+v", msg)
+	}
+	msg := exchange(t, clientConn, reader, fmt.Sprintf(failing, 5))
+	if msg.Method != "notifications/message" {
+		t.Fatalf("Expected a log message, got %+v", msg)
+	}
+	var params LogMessageParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatalf("Failed to parse log message: %v", err)
+	}
+	data, _ := params.Data.(map[string]interface{})
+	if params.Level != "error" || data["name"] != "db/query" || !strings.Contains(fmt.Sprint(data["error"]), "missing") {
+		t.Errorf("Unexpected log message %+v", params)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.Contains(line, `"id":5`) {
+		t.Errorf("Expected the response to request 5 after the log message, got %q (err: %v)", line, err)
+	}
+}
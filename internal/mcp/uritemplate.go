@@ -0,0 +1,62 @@
+package mcp
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// uriTemplate is a compiled RFC 6570 level 1 template such as sqlite://{database}/tables/{table}.
+// Each variable matches a single path segment; matched values are percent-decoded.
+type uriTemplate struct {
+	raw     string
+	pattern *regexp.Regexp
+	vars    []string
+}
+
+var templateVarPattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+func parseURITemplate(raw string) (*uriTemplate, error) {
+	matches := templateVarPattern.FindAllStringSubmatchIndex(raw, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("uri template %q has no variables", raw)
+	}
+
+	var pattern strings.Builder
+	var vars []string
+	last := 0
+	pattern.WriteString("^")
+	for _, m := range matches {
+		pattern.WriteString(regexp.QuoteMeta(raw[last:m[0]]))
+		pattern.WriteString("([^/?#]+)")
+		vars = append(vars, raw[m[2]:m[3]])
+		last = m[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(raw[last:]))
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, err
+	}
+	return &uriTemplate{raw: raw, pattern: re, vars: vars}, nil
+}
+
+// match returns the template variables extracted from uri, or false if it does not match
+func (t *uriTemplate) match(uri string) (map[string]string, bool) {
+	m := t.pattern.FindStringSubmatch(uri)
+	if m == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(t.vars))
+	for i, name := range t.vars {
+		value, err := url.PathUnescape(m[i+1])
+		if err != nil {
+			return nil, false
+		}
+		params[name] = value
+	}
+	return params, true
+}
@@ -0,0 +1,83 @@
+/*
+Package progress carries progress reporting and partial result delivery for
+long-running operations through a context.
+
+The transport layer attaches a Tracker to the context of a request whose
+client asked for progress updates. Code anywhere below it, such as query
+execution in the db package, reports progress or sends result chunks
+without knowing how they reach the client:
+
+	progress.FromContext(ctx).Report(float64(done), float64(total), "")
+
+Every Tracker method is safe to call on a nil Tracker, which is what
+FromContext returns when the client did not ask for progress.
+*/
+package progress
+
+import (
+	"context"
+	"sync"
+)
+
+// Tracker delivers progress updates and result chunks for one request
+type Tracker struct {
+	report func(current, total float64, message string) error
+	chunk  func(data interface{}) error
+
+	mu   sync.Mutex
+	last float64
+	sent bool
+}
+
+// New creates a tracker that delivers progress updates through report and
+// result chunks through chunk. A nil chunk disables streaming.
+func New(report func(current, total float64, message string) error, chunk func(data interface{}) error) *Tracker {
+	return &Tracker{report: report, chunk: chunk}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the tracker
+func NewContext(ctx context.Context, t *Tracker) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the tracker carried by ctx, or nil
+func FromContext(ctx context.Context) *Tracker {
+	t, _ := ctx.Value(contextKey{}).(*Tracker)
+	return t
+}
+
+// Report sends a progress update. Total is zero when unknown. Updates that do
+// not advance past the last one are dropped, so concurrent reporters cannot
+// make progress appear to go backwards.
+func (t *Tracker) Report(current, total float64, message string) {
+	if t == nil || t.report == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sent && current <= t.last {
+		return
+	}
+	t.last, t.sent = current, true
+	_ = t.report(current, total, message)
+}
+
+// Streaming reports whether result chunks can be delivered to the client
+func (t *Tracker) Streaming() bool {
+	return t != nil && t.chunk != nil
+}
+
+// Send delivers a partial result to the client
+func (t *Tracker) Send(data interface{}) error {
+	if !t.Streaming() {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.chunk(data)
+}
@@ -0,0 +1,52 @@
+package progress
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	// A context without a tracker yields a nil tracker that ignores calls
+	missing := FromContext(context.Background())
+	missing.Report(1, 2, "ignored")
+	if missing.Streaming() {
+		t.Error("Expected nil tracker not to stream")
+	}
+	if err := missing.Send("ignored"); err != nil {
+		t.Errorf("Send on nil tracker failed: %v", err)
+	}
+
+	var reports []float64
+	var chunks []interface{}
+	tracker := New(func(current, total float64, message string) error {
+		reports = append(reports, current)
+		return nil
+	}, func(data interface{}) error {
+		chunks = append(chunks, data)
+		return nil
+	})
+
+	ctx := NewContext(context.Background(), tracker)
+	if FromContext(ctx) != tracker {
+		t.Fatal("Expected tracker from context")
+	}
+
+	// Progress never goes backwards
+	for _, current := range []float64{1, 3, 2, 3, 4} {
+		tracker.Report(current, 4, "")
+	}
+	if len(reports) != 3 || reports[0] != 1 || reports[1] != 3 || reports[2] != 4 {
+		t.Errorf("Expected reports [1 3 4], got %v", reports)
+	}
+
+	if !tracker.Streaming() {
+		t.Error("Expected tracker with chunk function to stream")
+	}
+	if err := tracker.Send("chunk"); err != nil || len(chunks) != 1 {
+		t.Errorf("Expected one chunk, got %v (%v)", chunks, err)
+	}
+
+	if New(nil, nil).Streaming() {
+		t.Error("Expected tracker without chunk function not to stream")
+	}
+}